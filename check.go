@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tengattack/unified-ci/checker"
+	"github.com/tengattack/unified-ci/config"
+)
+
+// parseCheckTarget parses owner/repo/pull/N or owner/repo/tree/branch
+func parseCheckTarget(target string) (*checker.CheckRequest, error) {
+	parts := strings.SplitN(target, "/", 4)
+	if len(parts) != 4 || parts[0] == "" || parts[1] == "" || parts[3] == "" {
+		return nil, errors.New("invalid target: " + target)
+	}
+	req := &checker.CheckRequest{
+		Owner: parts[0],
+		Repo:  parts[1],
+	}
+	switch parts[2] {
+	case "pull":
+		prNum, err := strconv.Atoi(parts[3])
+		if err != nil || prNum <= 0 {
+			return nil, errors.New("invalid pull request number: " + parts[3])
+		}
+		req.PRNum = prNum
+	case "tree":
+		req.Branch = parts[3]
+	default:
+		return nil, errors.New("invalid target: " + target)
+	}
+	return req, nil
+}
+
+// runCheck asks the server to check a pull request or a branch
+func runCheck(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	configPath := flags.String("config", "", "config file, for the server address and admin token")
+	server := flags.String("server", "", "server URL, e.g. http://localhost:8098")
+	token := flags.String("token", "", "admin token")
+	sha := flags.String("sha", "", "commit to check (default: the head)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s check [options] owner/repo/pull/N | owner/repo/tree/branch\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	req, err := parseCheckTarget(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	req.Sha = *sha
+
+	if *configPath != "" {
+		conf, err := config.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *server == "" {
+			address := conf.API.Address
+			if address == "" {
+				address = "127.0.0.1"
+			}
+			*server = fmt.Sprintf("http://%s:%d", address, conf.API.Port)
+		}
+		if *token == "" {
+			*token = conf.API.AdminToken
+		}
+	}
+	if *server == "" {
+		fmt.Fprintln(os.Stderr, "Please specify a config file or the server URL")
+		os.Exit(1)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(*server, "/")+"/api/checks", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+*token)
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code int             `json:"code"`
+		Info json.RawMessage `json:"info"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "HTTP %s: %v\n", resp.Status, err)
+		os.Exit(1)
+	}
+	if result.Code != 0 {
+		fmt.Fprintf(os.Stderr, "HTTP %s: %s\n", resp.Status, result.Info)
+		os.Exit(1)
+	}
+	var info struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(result.Info, &info)
+	fmt.Println(info.ID)
+}
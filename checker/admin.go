@@ -0,0 +1,170 @@
+package checker
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tengattack/unified-ci/mq"
+	"github.com/tengattack/unified-ci/store"
+	githubhook "gopkg.in/rjz/githubhook.v0"
+)
+
+type adminEntry struct {
+	Message   string `json:"message"`
+	Key       string `json:"key"`
+	Retries   int64  `json:"retries"`
+	LastError string `json:"last_error,omitempty"`
+	Due       int64  `json:"due,omitempty"`
+}
+
+type adminMessageRequest struct {
+	Message string `json:"message" binding:"required"`
+}
+
+// AdminMiddleware checks the admin token in the Authorization header, the
+// admin endpoints are disabled if api.admin_token is empty
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if Conf.API.AdminToken == "" {
+			abortWithError(c, http.StatusForbidden, "admin api is disabled")
+			return
+		}
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(Conf.API.AdminToken)) != 1 {
+			abortWithError(c, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortWithQueueError(c *gin.Context, err error) {
+	if err == mq.ErrUnknownChannel || err == mq.ErrNotFound {
+		abortWithError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	LogError.Errorf("admin queue error: %v", err)
+	abortWithError(c, http.StatusInternalServerError, "queue error: "+err.Error())
+}
+
+func adminListHandler(c *gin.Context) {
+	entries, err := MQ.List(c.Param("channel"))
+	if err != nil {
+		abortWithQueueError(c, err)
+		return
+	}
+	list := make([]adminEntry, len(entries))
+	for i, e := range entries {
+		list[i] = adminEntry{
+			Message:   e.Message.String(),
+			Key:       e.Message.Key(),
+			Retries:   e.Retries,
+			LastError: e.LastError,
+		}
+		if !e.Due.IsZero() {
+			list[i].Due = e.Due.Unix()
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"info": list,
+	})
+}
+
+func adminRequeueHandler(c *gin.Context) {
+	var req adminMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, http.StatusBadRequest, "request error: "+err.Error())
+		return
+	}
+	// the message is identified by its raw form
+	message, _ := mq.ParseMessage(req.Message)
+	err := MQ.Requeue(c.Param("channel"), message)
+	if err != nil {
+		abortWithQueueError(c, err)
+		return
+	}
+	LogAccess.Infof("Requeue message from %s: %s", c.Param("channel"), message)
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"info": "requeue successfully",
+	})
+}
+
+func adminDropHandler(c *gin.Context) {
+	var req adminMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, http.StatusBadRequest, "request error: "+err.Error())
+		return
+	}
+	message, _ := mq.ParseMessage(req.Message)
+	err := MQ.Drop(c.Param("channel"), message)
+	if err != nil {
+		abortWithQueueError(c, err)
+		return
+	}
+	dropJobs(JobDropped, message)
+	LogAccess.Infof("Drop message from %s: %s", c.Param("channel"), message)
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"info": "drop successfully",
+	})
+}
+
+func adminPurgeHandler(c *gin.Context) {
+	messages, err := MQ.Purge(c.Param("channel"))
+	if err != nil {
+		abortWithQueueError(c, err)
+		return
+	}
+	dropJobs(JobDropped, messages...)
+	LogAccess.Infof("Purge %d message(s) from %s", len(messages), c.Param("channel"))
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"info": gin.H{
+			"count": len(messages),
+		},
+	})
+}
+
+func loadDelivery(c *gin.Context) *store.Delivery {
+	d, err := store.LoadDelivery(c.Param("id"))
+	if err != nil {
+		LogError.Errorf("LoadDelivery error: %v", err)
+		abortWithError(c, http.StatusInternalServerError, "load delivery error")
+		return nil
+	}
+	if d == nil {
+		abortWithError(c, http.StatusNotFound, "delivery not found")
+		return nil
+	}
+	return d
+}
+
+func adminDeliveryHandler(c *gin.Context) {
+	d := loadDelivery(c)
+	if d == nil {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"info": d,
+	})
+}
+
+// adminReplayHandler handles a stored delivery again, duplicate deliveries
+// are not checked
+func adminReplayHandler(c *gin.Context) {
+	d := loadDelivery(c)
+	if d == nil {
+		return
+	}
+	LogAccess.WithField("entry", "admin").Info("Replay delivery: " + d.ID)
+	handleHook(c, &githubhook.Hook{
+		Id:      d.ID,
+		Event:   d.Event,
+		Payload: d.Payload,
+	})
+}
@@ -0,0 +1,100 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tengattack/unified-ci/mq"
+	"github.com/tengattack/unified-ci/mq/sqlite"
+)
+
+func TestAdminHandlers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fileDB := "admin test.db"
+	q := sqlite.New(sqlite.Config{File: fileDB})
+	require.NoError(q.Init())
+	defer os.Remove(fileDB)
+	defer q.Deinit()
+	MQ = q
+	defer func() { MQ = nil }()
+
+	Conf.API.AdminToken = "secret"
+	defer func() { Conf.API.AdminToken = "" }()
+
+	m1 := mq.NewPullMessage("owner", "repo", 1, "sha1")
+	m2 := mq.NewPullMessage("owner", "repo", 2, "sha2")
+	require.NoError(q.Push(m1))
+	require.NoError(q.Push(m2))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := q.Subscribe(ctx, "worker1")
+	require.NoError(err)
+	require.NoError(q.Error(m1, "clone failed"))
+
+	_, r := gin.CreateTestContext(httptest.NewRecorder())
+	admin := r.Group("/api/admin", AdminMiddleware())
+	admin.GET("/queue/:channel", adminListHandler)
+	admin.POST("/queue/:channel/requeue", adminRequeueHandler)
+	admin.POST("/queue/:channel/drop", adminDropHandler)
+	admin.POST("/queue/:channel/purge", adminPurgeHandler)
+
+	do := func(method, url, token, body string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := do(http.MethodGet, "/api/admin/queue/error", "", "")
+	assert.Equal(http.StatusUnauthorized, resp.Code)
+	resp = do(http.MethodGet, "/api/admin/queue/error", "wrong", "")
+	assert.Equal(http.StatusUnauthorized, resp.Code)
+	resp = do(http.MethodGet, "/api/admin/queue/unknown", "secret", "")
+	assert.Equal(http.StatusNotFound, resp.Code)
+
+	resp = do(http.MethodGet, "/api/admin/queue/error", "secret", "")
+	require.Equal(http.StatusOK, resp.Code)
+	var list struct {
+		Info []adminEntry `json:"info"`
+	}
+	require.NoError(json.Unmarshal(resp.Body.Bytes(), &list))
+	require.Len(list.Info, 1)
+	assert.Equal(m1.String(), list.Info[0].Message)
+	assert.Equal(m1.Key(), list.Info[0].Key)
+	assert.EqualValues(1, list.Info[0].Retries)
+	assert.Equal("clone failed", list.Info[0].LastError)
+
+	body, err := json.Marshal(adminMessageRequest{Message: m1.String()})
+	require.NoError(err)
+	resp = do(http.MethodPost, "/api/admin/queue/error/requeue", "secret", string(body))
+	assert.Equal(http.StatusOK, resp.Code)
+	resp = do(http.MethodPost, "/api/admin/queue/error/requeue", "secret", string(body))
+	assert.Equal(http.StatusNotFound, resp.Code)
+	resp = do(http.MethodPost, "/api/admin/queue/error/requeue", "secret", "{}")
+	assert.Equal(http.StatusBadRequest, resp.Code)
+
+	resp = do(http.MethodPost, "/api/admin/queue/queue/drop", "secret", string(body))
+	assert.Equal(http.StatusOK, resp.Code)
+	resp = do(http.MethodPost, "/api/admin/queue/queue/purge", "secret", "")
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), `"count":1`)
+
+	// disabled
+	Conf.API.AdminToken = ""
+	resp = do(http.MethodGet, "/api/admin/queue/error", "", "")
+	assert.Equal(http.StatusForbidden, resp.Code)
+}
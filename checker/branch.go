@@ -0,0 +1,169 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-github/github"
+	"github.com/tengattack/unified-ci/mq"
+	"github.com/tengattack/unified-ci/store"
+	githubhook "gopkg.in/rjz/githubhook.v0"
+)
+
+const branchRefPrefix = "refs/heads/"
+
+// isCheckedBranch checks if the branch matches the configured branch patterns
+// or is protected when protected branches are checked
+func isCheckedBranch(ctx context.Context, client *github.Client, owner, repo, branch string) (bool, error) {
+	if MatchAny(Conf.GitHub.Branches, branch) {
+		return true, nil
+	}
+	if !Conf.GitHub.ProtectedBranches {
+		return false, nil
+	}
+	b, _, err := client.Repositories.GetBranch(ctx, owner, repo, branch)
+	if err != nil {
+		return false, err
+	}
+	return b.GetProtected(), nil
+}
+
+// listCheckedBranches lists the branches of repo to be checked
+func listCheckedBranches(ctx context.Context, client *github.Client, owner, repo string) ([]*github.Branch, error) {
+	var checked []*github.Branch
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		branches, resp, err := client.Repositories.ListBranches(ctx, owner, repo, opt)
+		if err != nil {
+			return checked, err
+		}
+		for _, b := range branches {
+			if MatchAny(Conf.GitHub.Branches, b.GetName()) ||
+				(Conf.GitHub.ProtectedBranches && b.GetProtected()) {
+				checked = append(checked, b)
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return checked, nil
+}
+
+// watchBranch promotes the saved tests of the branch head, or sends a checking
+// request if the head hasn't been checked
+func watchBranch(client *github.Client, owner, repo, branch, sha string, testsCount int) {
+	commitInfos, err := store.ListCommitsInfo(owner, repo, sha)
+	if err != nil {
+		LogError.Errorf("WatchLocalRepo:LoadCommitsInfo for %s error: %v", branch, err)
+		return
+	}
+	if len(commitInfos) >= testsCount {
+		// promote status
+		updated := false
+		for _, commitInfo := range commitInfos {
+			if commitInfo.Status == 0 {
+				err = commitInfo.UpdateStatus(1)
+				if err != nil {
+					LogError.Errorf("WatchLocalRepo:CommitInfo:UpdateStatus error: %v", err)
+					// PASS
+				} else {
+					updated = true
+				}
+			}
+		}
+		if updated {
+			LogAccess.Infof("CommitInfo %s/%s %s for %s status updated", owner, repo, sha, branch)
+		}
+		return
+	}
+
+	ref := GithubRef{
+		owner: owner,
+		repo:  repo,
+
+		Sha: sha,
+	}
+	message := mq.NewTreeMessage(ref.owner, ref.repo, branch, sha)
+	message.Event = "watch"
+	message.Priority = mq.PriorityBackground
+	needCheck, err := needPRChecking(client, &ref, message, MQ)
+	if err != nil {
+		LogError.Errorf("WatchLocalRepo:NeedPRChecking for %s error: %v", branch, err)
+		return
+	}
+	if needCheck {
+		// no statuses, need check
+		LogAccess.WithField("entry", "local").Info("Push message: " + message.String())
+		err = pushMessage(message)
+		if err == nil {
+			markAsPending(client, ref)
+		} else {
+			LogAccess.Error("Add message to queue error: " + err.Error())
+			// PASS
+		}
+	}
+}
+
+// pushEventHandler checks the pushed head of branches
+func pushEventHandler(c *gin.Context, hook *githubhook.Hook) {
+	var payload github.PushEvent
+	err := hook.Extract(&payload)
+	if err != nil {
+		abortWithError(c, 400, "payload error: "+err.Error())
+		return
+	}
+	ref := payload.GetRef()
+	if !strings.HasPrefix(ref, branchRefPrefix) || payload.GetDeleted() {
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"info": "no need to handle the push: " + ref,
+		})
+		return
+	}
+	branch := strings.TrimPrefix(ref, branchRefPrefix)
+	owner := payload.GetRepo().GetOwner().GetLogin()
+	if owner == "" {
+		owner = payload.GetRepo().GetOwner().GetName()
+	}
+	repo := payload.GetRepo().GetName()
+
+	client, err := getDefaultAPIClient(owner)
+	if err != nil {
+		LogAccess.Errorf("getDefaultAPIClient returns error: %v", err)
+		abortWithError(c, 500, "getDefaultAPIClient returns error")
+		return
+	}
+	checked, err := isCheckedBranch(c.Request.Context(), client, owner, repo, branch)
+	if err != nil {
+		LogAccess.Errorf("isCheckedBranch returns error: %v", err)
+		abortWithError(c, 500, "get branch error")
+		return
+	}
+	if !checked {
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"info": "no need to check the branch: " + branch,
+		})
+		return
+	}
+
+	message := mq.NewTreeMessage(owner, repo, branch, payload.GetAfter())
+	message.Event = hook.Event
+	message.DeliveryID = hook.Id
+	LogAccess.WithField("entry", "webhook").Info("Push message: " + message.String())
+	err = pushMessage(message)
+	if err != nil {
+		LogAccess.Error("Add message to queue error: " + err.Error())
+		abortWithError(c, 500, "add to queue error: "+err.Error())
+		return
+	}
+	markAsPending(client, GithubRef{owner: owner, repo: repo, Sha: payload.GetAfter()})
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"info": "add to queue successfully",
+	})
+}
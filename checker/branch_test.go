@@ -0,0 +1,66 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckedBranches(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	branches, protected := Conf.GitHub.Branches, Conf.GitHub.ProtectedBranches
+	defer func() {
+		Conf.GitHub.Branches, Conf.GitHub.ProtectedBranches = branches, protected
+	}()
+	Conf.GitHub.Branches = []string{"master", "release/*"}
+	Conf.GitHub.ProtectedBranches = true
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/branches", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name":"master","protected":false},{"name":"release/1.0"},`+
+			`{"name":"stable","protected":true},{"name":"feature","protected":false}]`)
+	})
+	mux.HandleFunc("/repos/owner/repo/branches/stable", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"stable","protected":true}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/branches/feature", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"feature","protected":false}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	ctx := context.Background()
+	list, err := listCheckedBranches(ctx, client, "owner", "repo")
+	require.NoError(err)
+	var names []string
+	for _, b := range list {
+		names = append(names, b.GetName())
+	}
+	assert.Equal([]string{"master", "release/1.0", "stable"}, names)
+
+	for branch, expected := range map[string]bool{
+		"release/2.0": true,
+		"stable":      true,
+		"feature":     false,
+	} {
+		checked, err := isCheckedBranch(ctx, client, "owner", "repo", branch)
+		assert.NoError(err)
+		assert.Equal(expected, checked, branch)
+	}
+
+	Conf.GitHub.ProtectedBranches = false
+	checked, err := isCheckedBranch(ctx, client, "owner", "repo", "stable")
+	assert.NoError(err)
+	assert.False(checked)
+}
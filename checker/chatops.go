@@ -0,0 +1,201 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-github/github"
+	"github.com/tengattack/unified-ci/mq"
+	githubhook "gopkg.in/rjz/githubhook.v0"
+)
+
+// ChatOpsPrefix starts a command in the comments of pull requests, e.g.
+// `/unified-ci test unit`
+const ChatOpsPrefix = "/unified-ci"
+
+const reactionsPreviewMediaType = "application/vnd.github.squirrel-girl-preview+json"
+
+// parseChatOpsCommand finds the first command line in comment body
+func parseChatOpsCommand(body string) (command string, args []string, ok bool) {
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != ChatOpsPrefix {
+			continue
+		}
+		if len(fields) == 1 {
+			return "", nil, true
+		}
+		return fields[1], fields[2:], true
+	}
+	return "", nil, false
+}
+
+// commandChecks returns the checks restricted by command, tests are validated
+// against the tests of the local repo if exists
+func commandChecks(command string, args []string, tests map[string]goTestsConfig) ([]string, error) {
+	switch command {
+	case "retest":
+		return nil, nil
+	case "lint":
+		return []string{mq.CheckLint}, nil
+	case "skip-lint":
+		return []string{mq.CheckTest}, nil
+	case "test":
+		if len(args) == 0 {
+			return []string{mq.CheckTest}, nil
+		}
+		checks := make([]string, 0, len(args))
+		for _, name := range args {
+			if len(tests) > 0 {
+				if _, ok := tests[name]; !ok {
+					return nil, errors.New("unknown test: " + name)
+				}
+			}
+			checks = append(checks, mq.CheckTest+":"+name)
+		}
+		return checks, nil
+	case "":
+		return nil, errors.New("missing command, available: retest, lint, test [name...], skip-lint")
+	}
+	return nil, errors.New("unknown command: " + command)
+}
+
+// hasWritePermission checks if user can write to the repository
+func hasWritePermission(ctx context.Context, client *github.Client, owner, repo, user string) (bool, error) {
+	level, _, err := client.Repositories.GetPermissionLevel(ctx, owner, repo, user)
+	if err != nil {
+		return false, err
+	}
+	switch level.GetPermission() {
+	case "admin", "write":
+		return true, nil
+	}
+	return false, nil
+}
+
+// answerComment reacts to the comment, and replies if reply is not empty
+func answerComment(ctx context.Context, client *github.Client, payload *github.IssueCommentEvent, reaction, reply string) {
+	owner, repo := payload.GetRepo().GetOwner().GetLogin(), payload.GetRepo().GetName()
+	u := fmt.Sprintf("repos/%s/%s/issues/comments/%d/reactions", owner, repo, payload.GetComment().GetID())
+	req, err := client.NewRequest("POST", u, &github.Reaction{Content: &reaction})
+	if err == nil {
+		req.Header.Set("Accept", reactionsPreviewMediaType)
+		_, err = client.Do(ctx, req, nil)
+	}
+	if err != nil {
+		LogError.Errorf("React to comment error: %v", err)
+		// PASS
+	}
+	if reply == "" {
+		return
+	}
+	body := fmt.Sprintf("> %s\n\n@%s %s", strings.TrimSpace(payload.GetComment().GetBody()),
+		payload.GetComment().GetUser().GetLogin(), reply)
+	_, _, err = client.Issues.CreateComment(ctx, owner, repo, payload.GetIssue().GetNumber(),
+		&github.IssueComment{Body: &body})
+	if err != nil {
+		LogError.Errorf("Reply to comment error: %v", err)
+		// PASS
+	}
+}
+
+// issueCommentHandler handles the ChatOps commands in pull request comments
+func issueCommentHandler(c *gin.Context, hook *githubhook.Hook) {
+	var payload github.IssueCommentEvent
+	err := hook.Extract(&payload)
+	if err != nil {
+		abortWithError(c, 400, "payload error: "+err.Error())
+		return
+	}
+	if payload.GetAction() != "created" || payload.GetIssue().GetPullRequestLinks() == nil ||
+		payload.GetComment().GetUser().GetType() == "Bot" {
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"info": "no need to handle the comment",
+		})
+		return
+	}
+	command, args, ok := parseChatOpsCommand(payload.GetComment().GetBody())
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"info": "no command found",
+		})
+		return
+	}
+
+	owner, repo := payload.GetRepo().GetOwner().GetLogin(), payload.GetRepo().GetName()
+	prNum := payload.GetIssue().GetNumber()
+	client, err := getDefaultAPIClient(owner)
+	if err != nil {
+		LogAccess.Errorf("getDefaultAPIClient returns error: %v", err)
+		abortWithError(c, 500, "getDefaultAPIClient returns error")
+		return
+	}
+	ctx := c.Request.Context()
+
+	// answer replies the outcome of command
+	answer := func(reaction, reply string) {
+		answerComment(ctx, client, &payload, reaction, reply)
+		info := reply
+		if info == "" {
+			info = "add to queue successfully"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"info": info,
+		})
+	}
+
+	user := payload.GetComment().GetUser().GetLogin()
+	allowed, err := hasWritePermission(ctx, client, owner, repo, user)
+	if err != nil {
+		LogAccess.Errorf("GetPermissionLevel returns error: %v", err)
+		abortWithError(c, 500, "get permission level error")
+		return
+	}
+	if !allowed {
+		answer("-1", "only users with write permission can run commands.")
+		return
+	}
+
+	repoConf, _ := readProjectConfig(filepath.Join(Conf.Core.WorkDir, owner, repo))
+	checks, err := commandChecks(command, args, repoConf.Tests)
+	if err != nil {
+		answer("confused", err.Error())
+		return
+	}
+
+	gpull, err := GetGithubPull(ctx, client, owner, repo, prNum)
+	if err != nil {
+		abortWithError(c, 500, "get pull request error")
+		return
+	}
+	if gpull.GetState() != "open" {
+		answer("confused", "the pull request is "+gpull.GetState()+".")
+		return
+	}
+
+	sha := gpull.GetHead().GetSHA()
+	message := mq.NewPullMessage(owner, repo, prNum, sha)
+	message.Event = hook.Event + "." + command
+	message.Checks = checks
+	message.Priority = mq.PriorityRerun
+	message.DeliveryID = hook.Id
+	LogAccess.WithField("entry", "webhook").Info("Push message: " + message.String())
+	err = pushMessage(message)
+	if err != nil {
+		LogAccess.Error("Add message to queue error: " + err.Error())
+		answer("confused", "failed to add to queue.")
+		return
+	}
+	if !message.Restricted() {
+		markAsPending(client, GithubRef{owner: owner, repo: repo, Sha: sha})
+	}
+	answer("rocket", "")
+}
@@ -0,0 +1,64 @@
+package checker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tengattack/unified-ci/mq"
+)
+
+func TestParseChatOpsCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	command, args, ok := parseChatOpsCommand("LGTM\n/unified-ci test unit e2e\n/unified-ci lint")
+	assert.True(ok)
+	assert.Equal("test", command)
+	assert.Equal([]string{"unit", "e2e"}, args)
+
+	command, args, ok = parseChatOpsCommand("  /unified-ci retest  ")
+	assert.True(ok)
+	assert.Equal("retest", command)
+	assert.Empty(args)
+
+	command, _, ok = parseChatOpsCommand("/unified-ci")
+	assert.True(ok)
+	assert.Empty(command)
+
+	for _, body := range []string{"LGTM", "> /unified-ci retest", "/unified-cis retest"} {
+		_, _, ok = parseChatOpsCommand(body)
+		assert.False(ok, body)
+	}
+}
+
+func TestCommandChecks(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := map[string]goTestsConfig{"unit": {}, "e2e": {}}
+	checks, err := commandChecks("retest", nil, tests)
+	assert.NoError(err)
+	assert.Empty(checks)
+
+	checks, err = commandChecks("lint", nil, tests)
+	assert.NoError(err)
+	assert.Equal([]string{mq.CheckLint}, checks)
+
+	checks, err = commandChecks("skip-lint", nil, tests)
+	assert.NoError(err)
+	assert.Equal([]string{mq.CheckTest}, checks)
+
+	checks, err = commandChecks("test", []string{"unit"}, tests)
+	assert.NoError(err)
+	assert.Equal([]string{"test:unit"}, checks)
+
+	// tests are unknown without local repo
+	checks, err = commandChecks("test", []string{"any"}, nil)
+	assert.NoError(err)
+	assert.Equal([]string{"test:any"}, checks)
+
+	_, err = commandChecks("test", []string{"unknown"}, tests)
+	assert.Error(err)
+	_, err = commandChecks("deploy", nil, tests)
+	assert.Error(err)
+	_, err = commandChecks("", nil, tests)
+	assert.Error(err)
+}
@@ -0,0 +1,153 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tengattack/unified-ci/mq"
+	"github.com/tengattack/unified-ci/store"
+)
+
+// ErrNotPullHead is returned when the sha of pull request check is not its head,
+// the older commits are not checked since the head supersedes them
+var ErrNotPullHead = errors.New("sha is not the head of pull request")
+
+// CheckRequest is the request to check a pull request or a branch on demand
+type CheckRequest struct {
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo"`
+	PRNum  int    `json:"pr,omitempty"`
+	Branch string `json:"branch,omitempty"`
+	// Sha is the commit to check, the head of pull request or branch is
+	// checked if it is empty, it must be the head for pull request
+	Sha string `json:"sha,omitempty"`
+}
+
+// Validate checks the required fields of request
+func (r *CheckRequest) Validate() error {
+	if r.Owner == "" || r.Repo == "" {
+		return errors.New("owner and repo are required")
+	}
+	if (r.PRNum > 0) == (r.Branch != "") {
+		return errors.New("either pr or branch is required")
+	}
+	return nil
+}
+
+// EnqueueCheck pushes the check job of request to the queue
+func EnqueueCheck(ctx context.Context, req *CheckRequest) (*mq.Message, error) {
+	client, err := getDefaultAPIClient(req.Owner)
+	if err != nil {
+		return nil, err
+	}
+	sha := req.Sha
+	if req.PRNum > 0 {
+		// the message of pull request becomes its head in queue
+		gpull, err := GetGithubPull(ctx, client, req.Owner, req.Repo, req.PRNum)
+		if err != nil {
+			return nil, fmt.Errorf("GetGithubPull error: %v", err)
+		}
+		if sha != "" && sha != gpull.GetHead().GetSHA() {
+			return nil, ErrNotPullHead
+		}
+		sha = gpull.GetHead().GetSHA()
+	} else if sha == "" {
+		branch, _, err := client.Repositories.GetBranch(ctx, req.Owner, req.Repo, req.Branch)
+		if err != nil {
+			return nil, fmt.Errorf("GetBranch error: %v", err)
+		}
+		sha = branch.GetCommit().GetSHA()
+	}
+
+	var message *mq.Message
+	if req.PRNum > 0 {
+		message = mq.NewPullMessage(req.Owner, req.Repo, req.PRNum, sha)
+	} else {
+		message = mq.NewTreeMessage(req.Owner, req.Repo, req.Branch, sha)
+	}
+	message.Event = "manual"
+	message.Priority = mq.PriorityRerun
+	LogAccess.WithField("entry", "api").Info("Push message: " + message.String())
+	err = pushMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	markAsPending(client, GithubRef{owner: req.Owner, repo: req.Repo, Sha: sha})
+	return message, nil
+}
+
+func checksHandler(c *gin.Context) {
+	var req CheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, http.StatusBadRequest, "request error: "+err.Error())
+		return
+	}
+	if err := req.Validate(); err != nil {
+		abortWithError(c, http.StatusBadRequest, "request error: "+err.Error())
+		return
+	}
+	message, err := EnqueueCheck(c.Request.Context(), &req)
+	if err == ErrNotPullHead {
+		abortWithError(c, http.StatusBadRequest, "request error: "+err.Error())
+		return
+	}
+	if err != nil {
+		LogAccess.Errorf("EnqueueCheck returns error: %v", err)
+		abortWithError(c, http.StatusInternalServerError, "add to queue error: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"info": gin.H{
+			"id":      message.ID,
+			"message": message.String(),
+		},
+	})
+}
+
+func checkStatusHandler(c *gin.Context) {
+	id := c.Param("id")
+	for _, channel := range mq.Channels {
+		entries, err := MQ.List(channel)
+		if err != nil {
+			abortWithQueueError(c, err)
+			return
+		}
+		for _, e := range entries {
+			if e.Message.ID != id {
+				continue
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"code": 0,
+				"info": gin.H{
+					"id":         id,
+					"message":    e.Message.String(),
+					"channel":    channel,
+					"retries":    e.Retries,
+					"last_error": e.LastError,
+				},
+			})
+			return
+		}
+	}
+	job, err := store.LoadJob(id)
+	if err != nil {
+		LogError.Errorf("LoadJob error: %v", err)
+		abortWithError(c, http.StatusInternalServerError, "load job error")
+		return
+	}
+	if job == nil {
+		abortWithError(c, http.StatusNotFound, "job not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"info": gin.H{
+			"id":  id,
+			"job": job,
+		},
+	})
+}
@@ -0,0 +1,73 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tengattack/unified-ci/mq"
+	"github.com/tengattack/unified-ci/mq/sqlite"
+)
+
+func TestCheckRequestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&CheckRequest{Owner: "owner", Repo: "repo", PRNum: 1}).Validate())
+	assert.NoError((&CheckRequest{Owner: "owner", Repo: "repo", Branch: "release/1.0"}).Validate())
+	assert.Error((&CheckRequest{Owner: "owner", Repo: "repo"}).Validate())
+	assert.Error((&CheckRequest{Owner: "owner", Repo: "repo", PRNum: 1, Branch: "master"}).Validate())
+	assert.Error((&CheckRequest{Repo: "repo", PRNum: 1}).Validate())
+}
+
+func TestChecksHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fileDB := "checks test.db"
+	q := sqlite.New(sqlite.Config{File: fileDB})
+	require.NoError(q.Init())
+	defer os.Remove(fileDB)
+	defer q.Deinit()
+	MQ = q
+	defer func() { MQ = nil }()
+	defer useTestStore(t, "checks store test.db")()
+
+	_, r := gin.CreateTestContext(httptest.NewRecorder())
+	r.POST("/api/checks", checksHandler)
+	r.GET("/api/checks/:id", checkStatusHandler)
+
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/checks", strings.NewReader(`{"owner":"owner","repo":"repo"}`))
+	r.ServeHTTP(resp, req)
+	assert.Equal(http.StatusBadRequest, resp.Code)
+
+	m := mq.NewTreeMessage("owner", "repo", "release/1.0", "sha")
+	require.NoError(pushMessage(m))
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/checks/"+m.ID, nil)
+	r.ServeHTTP(resp, req)
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), `"channel":"queue"`)
+
+	// finished jobs are loaded from store
+	_, err := q.Subscribe(context.Background(), "worker1")
+	require.NoError(err)
+	require.NoError(q.Finish(m))
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/checks/"+m.ID, nil)
+	r.ServeHTTP(resp, req)
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), `"status":"queued"`)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/checks/unknown", nil)
+	r.ServeHTTP(resp, req)
+	assert.Equal(http.StatusNotFound, resp.Code)
+}
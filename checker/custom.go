@@ -0,0 +1,335 @@
+package checker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// Output formats of custom linters
+const (
+	formatCheckstyle  = "checkstyle"
+	formatSARIF       = "sarif"
+	formatCodeClimate = "codeclimate"
+	formatRegexp      = "regex"
+	formatDiff        = "diff"
+)
+
+// defaultLintPattern matches the common `file:line:col: message` output, the
+// column is optional
+const defaultLintPattern = `^(?P<file>[^:]+):(?P<line>\d+):(?:(?P<column>\d+):)?\s*(?P<message>.+)$`
+
+// customLinterConfig is a linter declared in the project config
+type customLinterConfig struct {
+	// Cmd is run in the repository for each changed file if it contains
+	// {file}, which is replaced by the file path, otherwise it runs once for
+	// the whole repository
+	Cmd string `yaml:"cmd"`
+	// Files are the glob patterns of files checked by the linter, it checks
+	// all files if empty
+	Files []string `yaml:"files"`
+	// Format is the output format: checkstyle, sarif, codeclimate, regex or
+	// diff
+	Format string `yaml:"format"`
+	// Pattern is the regexp of regex format, the named groups file, line,
+	// column, message, rule and severity are recognized
+	Pattern string `yaml:"pattern"`
+}
+
+// customLinter runs the command declared in the project config
+type customLinter struct {
+	baseLinter
+	config  customLinterConfig
+	pattern *regexp.Regexp
+}
+
+type customFileLinter struct {
+	*customLinter
+}
+
+type customRepoLinter struct {
+	*customLinter
+}
+
+// newCustomLinter validates the config and returns the linter
+func newCustomLinter(name string, c customLinterConfig) (Linter, error) {
+	if strings.TrimSpace(c.Cmd) == "" {
+		return nil, fmt.Errorf("linter %s: cmd is required", name)
+	}
+	l := &customLinter{
+		baseLinter: baseLinter{
+			name: name,
+			match: func(fileName string) bool {
+				return len(c.Files) == 0 || MatchAny(c.Files, fileName)
+			},
+		},
+		config: c,
+	}
+	switch c.Format {
+	case formatCheckstyle, formatSARIF, formatCodeClimate, formatDiff:
+	case formatRegexp:
+		pattern := c.Pattern
+		if pattern == "" {
+			pattern = defaultLintPattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("linter %s: %v", name, err)
+		}
+		groups := make(map[string]bool)
+		for _, g := range re.SubexpNames() {
+			groups[g] = true
+		}
+		if !groups["line"] || !groups["message"] {
+			return nil, fmt.Errorf("linter %s: pattern should contain the line and message groups", name)
+		}
+		l.pattern = re
+	default:
+		return nil, fmt.Errorf("linter %s: unknown format %q", name, c.Format)
+	}
+	if strings.Contains(c.Cmd, "{file}") {
+		return &customFileLinter{l}, nil
+	}
+	return &customRepoLinter{l}, nil
+}
+
+// CustomLinters returns the linters declared in the project config, sorted by
+// their names
+func (c *projectConfig) CustomLinters() ([]Linter, error) {
+	names := make([]string, 0, len(c.Linters))
+	for name := range c.Linters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	linters := make([]Linter, len(names))
+	for i, name := range names {
+		l, err := newCustomLinter(name, c.Linters[name])
+		if err != nil {
+			return nil, err
+		}
+		linters[i] = l
+	}
+	return linters, nil
+}
+
+// LintFile runs the command for the file, the messages of other files are
+// dropped
+func (l *customFileLinter) LintFile(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error) {
+	lints, output, err := l.run(ctx, ref, repoPath, fileName)
+	if err != nil {
+		return nil, output, err
+	}
+	var filtered []LintMessage
+	for _, lint := range lints {
+		if lint.FilePath == fileName {
+			filtered = append(filtered, lint)
+		}
+	}
+	return filtered, output, nil
+}
+
+// LintRepo runs the command for the whole repository
+func (l *customRepoLinter) LintRepo(ctx context.Context, ref GithubRef, repoPath string) ([]LintMessage, string, error) {
+	return l.run(ctx, ref, repoPath, "")
+}
+
+func (l *customLinter) run(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error) {
+	parser := NewShellParser(repoPath, ref)
+	words, err := parser.Parse(l.config.Cmd)
+	if err == nil && len(words) < 1 {
+		err = errors.New("cmd is empty")
+	}
+	if err != nil {
+		LogError.Errorf("Linter %s: %v", l.name, err)
+		return nil, "", err
+	}
+	for i, w := range words {
+		words[i] = strings.Replace(w, "{file}", fileName, -1)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, words[0], words[1:]...)
+	cmd.Dir = repoPath
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	LogAccess.Debugf("Linter %s Output:\n%s", l.name, out)
+	if err != nil {
+		// the exit status is not 0 when the linter finds problems
+		if _, ok := err.(*exec.ExitError); !ok || len(bytes.TrimSpace(out)) == 0 {
+			return nil, stderr.String(), err
+		}
+	}
+
+	lints, err := l.parse(out)
+	if err != nil {
+		return nil, stderr.String(), fmt.Errorf("parse output error: %v", err)
+	}
+	absRepoPath, err := filepath.Abs(repoPath)
+	if err != nil {
+		return nil, stderr.String(), err
+	}
+	for i, lint := range lints {
+		lints[i].FilePath = relativeLintPath(absRepoPath, lint.FilePath, fileName)
+	}
+	return lints, stderr.String(), nil
+}
+
+// relativeLintPath returns the path relative to repository of the file
+// reported by linter, defaultPath is used if it is not reported
+func relativeLintPath(absRepoPath, filePath, defaultPath string) string {
+	if filePath == "" {
+		return defaultPath
+	}
+	if filepath.IsAbs(filePath) {
+		if rel, err := filepath.Rel(absRepoPath, filePath); err == nil {
+			filePath = rel
+		}
+	}
+	return path.Clean(filepath.ToSlash(filePath))
+}
+
+func (l *customLinter) parse(out []byte) ([]LintMessage, error) {
+	switch l.config.Format {
+	case formatCheckstyle:
+		return ParseCheckstyle(out)
+	case formatSARIF:
+		return ParseSARIF(out)
+	case formatCodeClimate:
+		return ParseCodeClimate(out)
+	case formatRegexp:
+		return parseRegexpLints(out, l.pattern), nil
+	case formatDiff:
+		return parseDiffLints(out, l.name)
+	}
+	return nil, fmt.Errorf("unknown format %q", l.config.Format)
+}
+
+// ParseCheckstyle parses the checkstyle XML into lint messages
+func ParseCheckstyle(out []byte) ([]LintMessage, error) {
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+	var result CheckstyleResult
+	err := xml.Unmarshal(out, &result)
+	if err != nil {
+		return nil, err
+	}
+	var lints []LintMessage
+	for _, f := range result.File {
+		for _, e := range f.Error {
+			lints = append(lints, LintMessage{
+				FilePath: f.Name,
+				RuleID:   e.Source,
+				Severity: lintSeverity(e.Severity),
+				Line:     e.Line,
+				Column:   e.Column,
+				Message:  e.Message,
+			})
+		}
+	}
+	return lints, nil
+}
+
+// ParseCodeClimate parses the code climate JSON into lint messages, it is
+// either an array or a stream of issues separated by NUL characters
+func ParseCodeClimate(out []byte) ([]LintMessage, error) {
+	out = bytes.TrimSpace(bytes.Replace(out, []byte{0}, []byte{'\n'}, -1))
+	var issues []CodeClimate
+	if len(out) > 0 && out[0] == '[' {
+		err := json.Unmarshal(out, &issues)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(out))
+		for dec.More() {
+			var issue CodeClimate
+			err := dec.Decode(&issue)
+			if err != nil {
+				return nil, err
+			}
+			issues = append(issues, issue)
+		}
+	}
+	lints := make([]LintMessage, len(issues))
+	for i, v := range issues {
+		lints[i] = LintMessage{
+			FilePath: v.Location.Path,
+			RuleID:   v.CheckName,
+			Severity: codeClimateSeverity(v.Severity),
+			Line:     v.Location.Lines.Begin,
+			Message:  v.Description,
+		}
+	}
+	return lints, nil
+}
+
+// parseRegexpLints parses the lines of output matching the pattern
+func parseRegexpLints(out []byte, pattern *regexp.Regexp) []LintMessage {
+	var lints []LintMessage
+	names := pattern.SubexpNames()
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		match := pattern.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		lint := LintMessage{Severity: severityLevelWarning}
+		for i, m := range match {
+			switch names[i] {
+			case "file":
+				lint.FilePath = m
+			case "line":
+				lint.Line, _ = strconv.Atoi(m)
+			case "column":
+				lint.Column, _ = strconv.Atoi(m)
+			case "message":
+				lint.Message = strings.TrimSpace(m)
+			case "rule":
+				lint.RuleID = m
+			case "severity":
+				lint.Severity = lintSeverity(m)
+			}
+		}
+		lints = append(lints, lint)
+	}
+	return lints
+}
+
+// parseDiffLints parses the unified diff of formatter into formatting
+// suggestions
+func parseDiffLints(out []byte, ruleID string) ([]LintMessage, error) {
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+	diffs, err := diff.ParseMultiFileDiff(out)
+	if err != nil {
+		return nil, err
+	}
+	var lints []LintMessage
+	for _, d := range diffs {
+		fileName, _ := getTrimmedNewName(d)
+		for _, lint := range getLintsFromDiff(d, nil, ruleID) {
+			lint.FilePath = fileName
+			lints = append(lints, lint)
+		}
+	}
+	return lints, nil
+}
@@ -0,0 +1,120 @@
+package checker
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCustomLints(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	lints, err := ParseCheckstyle([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<checkstyle version="4.3">
+  <file name="a.sh">
+    <error line="3" column="6" severity="error" message="Double quote to prevent globbing" source="ShellCheck.SC2086"/>
+  </file>
+</checkstyle>`))
+	require.NoError(err)
+	assert.Equal([]LintMessage{{
+		FilePath: "a.sh",
+		RuleID:   "ShellCheck.SC2086",
+		Severity: severityLevelError,
+		Line:     3,
+		Column:   6,
+		Message:  "Double quote to prevent globbing",
+	}}, lints)
+
+	lints, err = ParseSARIF([]byte(`{"version":"2.1.0","runs":[{"tool":{"driver":{"name":"semgrep"}},"results":[
+{"ruleId":"no-eval","level":"warning","message":{"text":"eval is evil"},
+ "locations":[{"physicalLocation":{"artifactLocation":{"uri":"src/a%20b.js"},"region":{"startLine":7,"startColumn":2}}}]}]}]}`))
+	require.NoError(err)
+	assert.Equal([]LintMessage{{
+		FilePath: "src/a b.js",
+		RuleID:   "no-eval",
+		Severity: severityLevelWarning,
+		Line:     7,
+		Column:   2,
+		Message:  "eval is evil",
+	}}, lints)
+
+	issue := `{"check_name":"E501","description":"line too long","location":{"path":"a.py","lines":{"begin":4}}}`
+	for _, out := range []string{"[" + issue + "]", issue + "\x00" + issue} {
+		lints, err = ParseCodeClimate([]byte(out))
+		require.NoError(err)
+		require.NotEmpty(lints)
+		assert.Equal(LintMessage{FilePath: "a.py", RuleID: "E501", Severity: severityLevelError, Line: 4, Message: "line too long"}, lints[0])
+	}
+	lints, err = ParseCodeClimate(nil)
+	require.NoError(err)
+	assert.Empty(lints)
+
+	lints = parseRegexpLints([]byte("a.py:1:2: first\nnoise\nb.py:3: second\n"), regexp.MustCompile(defaultLintPattern))
+	assert.Equal([]LintMessage{
+		{FilePath: "a.py", Severity: severityLevelWarning, Line: 1, Column: 2, Message: "first"},
+		{FilePath: "b.py", Severity: severityLevelWarning, Line: 3, Message: "second"},
+	}, lints)
+
+	lints, err = parseDiffLints([]byte("--- a.sh.orig\n+++ a.sh\n@@ -1,2 +1,2 @@\n a\n-if [ 1 ];then\n+if [ 1 ]; then\n"), "shfmt")
+	require.NoError(err)
+	require.Len(lints, 1)
+	assert.Equal("a.sh", lints[0].FilePath)
+	assert.Equal("shfmt", lints[0].RuleID)
+	assert.Equal(2, lints[0].Line)
+	assert.True(lints[0].Formatted)
+}
+
+func TestNewCustomLinter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, err := newCustomLinter("empty", customLinterConfig{Format: formatCheckstyle})
+	assert.EqualError(err, "linter empty: cmd is required")
+	_, err = newCustomLinter("unknown", customLinterConfig{Cmd: "lint", Format: "xml"})
+	assert.EqualError(err, `linter unknown: unknown format "xml"`)
+	_, err = newCustomLinter("nogroup", customLinterConfig{Cmd: "lint", Format: formatRegexp, Pattern: `^(.+)$`})
+	assert.EqualError(err, "linter nogroup: pattern should contain the line and message groups")
+
+	l, err := newCustomLinter("shellcheck", customLinterConfig{Cmd: "shellcheck {file}", Format: formatCheckstyle, Files: []string{"**/*.sh"}})
+	require.NoError(err)
+	assert.Implements((*FileLinter)(nil), l)
+	assert.True(l.Enabled(""))
+	assert.True(l.Match("scripts/a.sh"))
+	assert.False(l.Match("a.py"))
+
+	l, err = newCustomLinter("mypy", customLinterConfig{Cmd: "mypy .", Format: formatRegexp})
+	require.NoError(err)
+	assert.Implements((*RepoLinter)(nil), l)
+	assert.True(l.Match("a.py"))
+
+	c := projectConfig{Linters: map[string]customLinterConfig{
+		"b": {Cmd: "b", Format: formatDiff},
+		"a": {Cmd: "a", Format: formatSARIF},
+	}}
+	linters, err := c.CustomLinters()
+	require.NoError(err)
+	assert.Equal([]string{"a", "b"}, linterNames(linters))
+}
+
+func TestCustomLinterRun(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	l, err := newCustomLinter("echo", customLinterConfig{
+		Cmd:    `sh -c 'echo "{file}:2:1: bad"; echo "other.sh:1: dropped"; exit 1'`,
+		Format: formatRegexp,
+	})
+	require.NoError(err)
+	lints, _, err := l.(FileLinter).LintFile(context.TODO(), GithubRef{}, "../testdata", "a.sh")
+	require.NoError(err)
+	assert.Equal([]LintMessage{{FilePath: "a.sh", Severity: severityLevelWarning, Line: 2, Column: 1, Message: "bad"}}, lints)
+
+	l, err = newCustomLinter("fail", customLinterConfig{Cmd: "sh -c 'exit 1'", Format: formatRegexp})
+	require.NoError(err)
+	_, _, err = l.(RepoLinter).LintRepo(context.TODO(), GithubRef{}, "../testdata")
+	assert.Error(err)
+}
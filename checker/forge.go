@@ -0,0 +1,45 @@
+package checker
+
+import (
+	"errors"
+	"path"
+
+	"github.com/tengattack/unified-ci/forge"
+	giteaforge "github.com/tengattack/unified-ci/forge/gitea"
+	githubforge "github.com/tengattack/unified-ci/forge/github"
+	gitlabforge "github.com/tengattack/unified-ci/forge/gitlab"
+)
+
+// getForge returns the forge hosting the repositories of owner, name is
+// empty for GitHub
+func getForge(name, owner string) (forge.Forge, error) {
+	switch name {
+	case "", forge.GitHub:
+		installationID, ok := GetInstallationID(owner)
+		if !ok {
+			return nil, errors.New("Installation ID not found, owner: " + owner)
+		}
+		return githubforge.New(installationID)
+	case forge.GitLab:
+		if !Conf.GitLab.Enabled {
+			return nil, errors.New("GitLab is not enabled")
+		}
+		return gitlabforge.New(Conf.GitLab.BaseURL, Conf.GitLab.Token, nil), nil
+	case forge.Gitea:
+		if !Conf.Gitea.Enabled {
+			return nil, errors.New("Gitea is not enabled")
+		}
+		return giteaforge.New(Conf.Gitea.BaseURL, Conf.Gitea.Token, nil), nil
+	}
+	return nil, forge.ErrUnknownForge
+}
+
+// repositoryPath returns the path of repository under the work and logs
+// directories, the repositories of other forges than GitHub are placed in
+// the directory named after the forge
+func repositoryPath(forgeName, owner, repo string) string {
+	if forgeName == "" || forgeName == forge.GitHub {
+		return owner + "/" + repo
+	}
+	return path.Join(forgeName, owner, repo)
+}
@@ -0,0 +1,114 @@
+package checker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tengattack/unified-ci/forge"
+	giteaforge "github.com/tengattack/unified-ci/forge/gitea"
+	"github.com/tengattack/unified-ci/mq"
+)
+
+// giteaWebhookHandler handles the deliveries of Gitea, they are sent to the
+// same URI as GitHub
+func giteaWebhookHandler(c *gin.Context) {
+	if !Conf.Gitea.Enabled {
+		abortWithError(c, 404, "Gitea is not enabled")
+		return
+	}
+
+	payload, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		abortWithError(c, 400, "read payload error: "+err.Error())
+		return
+	}
+	if !giteaforge.VerifySignature(payload, c.GetHeader(giteaforge.HeaderSignature), Conf.Gitea.Secret) {
+		LogAccess.Error("Check Gitea signature error")
+		abortWithError(c, 403, "check signature error")
+		return
+	}
+	LogAccess.Debugf("%s", payload)
+
+	event := c.GetHeader(giteaforge.HeaderEvent)
+	switch event {
+	case giteaforge.EventPullRequest:
+		giteaPullRequestHandler(c, payload)
+	default:
+		abortWithError(c, 415, "unsupported event: "+event)
+	}
+}
+
+func giteaPullRequestHandler(c *gin.Context, data []byte) {
+	var payload giteaforge.PullRequestEvent
+	err := json.Unmarshal(data, &payload)
+	if err != nil {
+		abortWithError(c, 400, "payload error: "+err.Error())
+		return
+	}
+	pr := payload.PullRequest
+	draft := pr.Draft || giteaforge.IsWorkInProgress(pr.Title)
+	switch payload.Action {
+	case "opened", "reopened", "synchronized":
+	case "edited":
+		// the work in progress prefix is removed from title
+		if payload.Changes.Title == nil || draft || !giteaforge.IsWorkInProgress(payload.Changes.Title.From) {
+			c.JSON(http.StatusOK, gin.H{
+				"code": 0,
+				"info": "no need to handle the edit",
+			})
+			return
+		}
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"info": "no need to handle the action: " + payload.Action,
+		})
+		return
+	}
+	owner, repo := payload.Repository.Owner.Login, payload.Repository.Name
+	if owner == "" || repo == "" || pr.Number <= 0 || pr.Head.Sha == "" {
+		abortWithError(c, 400, "payload error: missing repository, number or head")
+		return
+	}
+	if draft && skipDraft(forge.Gitea, owner, repo) {
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"info": "skip draft pull request",
+		})
+		return
+	}
+
+	message := mq.NewPullMessage(owner, repo, pr.Number, pr.Head.Sha)
+	message.Forge = forge.Gitea
+	message.Event = giteaforge.EventPullRequest + "." + payload.Action
+	LogAccess.WithField("entry", "gitea").Info("Push message: " + message.String())
+	f, err := getForge(forge.Gitea, owner)
+	if err != nil {
+		abortWithError(c, 500, "create forge client error: "+err.Error())
+		return
+	}
+	// the deliveries may arrive out of order
+	pull, err := f.GetPullRequest(c.Request.Context(), owner, repo, pr.Number)
+	if err != nil {
+		LogAccess.Errorf("GetPullRequest error: %v", err)
+		abortWithError(c, 500, "get pull request error")
+		return
+	}
+	err = pushHeadMessage(message, pull.HeadSHA)
+	if err == ErrNotPullHead {
+		skipNotPullHead(c, message)
+		return
+	}
+	if err != nil {
+		LogAccess.Error("Add message to queue error: " + err.Error())
+		abortWithError(c, 500, "add to queue error: "+err.Error())
+		return
+	}
+	markForgeAsPending(f, GithubRef{owner: owner, repo: repo, Sha: pr.Head.Sha})
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"info": "add to queue successfully",
+	})
+}
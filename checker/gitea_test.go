@@ -0,0 +1,114 @@
+package checker
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tengattack/unified-ci/forge"
+	giteaforge "github.com/tengattack/unified-ci/forge/gitea"
+	"github.com/tengattack/unified-ci/mq"
+	"github.com/tengattack/unified-ci/mq/sqlite"
+)
+
+func TestGiteaWebhook(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	gitea := Conf.Gitea
+	defer func() { Conf.Gitea = gitea }()
+
+	var statuses []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repos/", func(w http.ResponseWriter, r *http.Request) {
+		statuses = append(statuses, r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/api/v1/repos/owner/repo/pulls/5", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"number":5,"state":"open","head":{"sha":"sha"}}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	Conf.Gitea.Enabled = true
+	Conf.Gitea.BaseURL = server.URL + "/api/v1/"
+	Conf.Gitea.Token = "token"
+	Conf.Gitea.Secret = "secret"
+
+	fileDB := "gitea test.db"
+	q := sqlite.New(sqlite.Config{File: fileDB})
+	require.NoError(q.Init())
+	defer os.Remove(fileDB)
+	defer q.Deinit()
+	MQ = q
+	defer func() { MQ = nil }()
+
+	_, r := gin.CreateTestContext(httptest.NewRecorder())
+	r.POST("/api/webhook", webhookHandler)
+	send := func(secret, event, payload string) *httptest.ResponseRecorder {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(payload))
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/webhook", strings.NewReader(payload))
+		req.Header.Set(giteaforge.HeaderEvent, event)
+		req.Header.Set(giteaforge.HeaderSignature, hex.EncodeToString(mac.Sum(nil)))
+		// Gitea sends the GitHub event as well
+		req.Header.Set("X-GitHub-Event", event)
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+	payload := func(action, title, changes string) string {
+		return `{"action":"` + action + `","number":5,"pull_request":{"number":5,"title":"` + title + `",` +
+			`"head":{"sha":"sha"}},"changes":` + changes + `,"repository":{"name":"repo","owner":{"login":"owner"}}}`
+	}
+
+	assert.Equal(http.StatusForbidden, send("wrong", giteaforge.EventPullRequest, payload("opened", "feature", "{}")).Code)
+	assert.Equal(http.StatusUnsupportedMediaType, send("secret", "push", `{}`).Code)
+	assert.Equal(http.StatusBadRequest, send("secret", giteaforge.EventPullRequest, `{"action":"opened"}`).Code)
+
+	resp := send("secret", giteaforge.EventPullRequest, payload("edited", "feature", `{"body":{"from":""}}`))
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), "no need to handle the edit")
+	resp = send("secret", giteaforge.EventPullRequest, payload("closed", "feature", "{}"))
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), "no need to handle")
+	entries, err := MQ.List(mq.ChannelQueue)
+	require.NoError(err)
+	assert.Empty(entries)
+
+	// ready for review
+	resp = send("secret", giteaforge.EventPullRequest, payload("edited", "feature", `{"title":{"from":"WIP: feature"}}`))
+	assert.Equal(http.StatusOK, resp.Code)
+	entries, err = MQ.List(mq.ChannelQueue)
+	require.NoError(err)
+	require.Len(entries, 1)
+	m := entries[0].Message
+	assert.Equal(forge.Gitea, m.Forge)
+	assert.Equal("owner", m.Owner)
+	assert.Equal("repo", m.Repo)
+	assert.Equal(5, m.PRNum)
+	assert.Equal("sha", m.Sha)
+	assert.Equal("pull_request.edited", m.Event)
+	// marked as pending
+	assert.Equal([]string{"/api/v1/repos/owner/repo/statuses/sha"}, statuses)
+
+	// the delivery of an older commit arrives after the head
+	resp = send("secret", giteaforge.EventPullRequest,
+		strings.Replace(payload("synchronized", "feature", "{}"), `"sha":"sha"`, `"sha":"old"`, 1))
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), "not the head")
+	entries, err = MQ.List(mq.ChannelQueue)
+	require.NoError(err)
+	require.Len(entries, 1)
+	assert.Equal(m.ID, entries[0].Message.ID)
+	superseded, err := MQ.Superseded(m)
+	require.NoError(err)
+	assert.False(superseded)
+}
@@ -15,16 +15,15 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/go-github/github"
 	"github.com/sourcegraph/go-diff/diff"
+	"github.com/tengattack/unified-ci/forge"
+	giteaforge "github.com/tengattack/unified-ci/forge/gitea"
+	githubforge "github.com/tengattack/unified-ci/forge/github"
 	"github.com/tengattack/unified-ci/mq"
 	"github.com/tengattack/unified-ci/store"
 	"github.com/tengattack/unified-ci/util"
 	githubhook "gopkg.in/rjz/githubhook.v0"
 )
 
-const (
-	GITHUB_API_URL = "https://api.github.com"
-)
-
 type githubUser struct {
 	ID    int64  `json:"id"`
 	Login string `json:"login"`
@@ -36,6 +35,7 @@ type GithubPull struct {
 	Number int64      `json:"number"`
 	State  string     `json:"state"`
 	Title  string     `json:"title"`
+	Draft  bool       `json:"draft"`
 	Head   GithubRef  `json:"head"`
 	Base   GithubRef  `json:"base"`
 	User   githubUser `json:"user"`
@@ -116,16 +116,6 @@ func GetGithubPull(ctx context.Context, client *github.Client, owner, repo strin
 	return thePull, nil
 }
 
-// GetGithubPullDiff gets the diff of the pull request.
-func GetGithubPullDiff(ctx context.Context, client *github.Client, owner, repo string, prNum int) ([]byte, error) {
-	got, _, err := client.PullRequests.GetRaw(ctx, owner, repo, prNum, github.RawOptions{github.Diff})
-	if err != nil {
-		LogError.Errorf("PullRequests.GetRaw returned error: %v", err)
-		return nil, err
-	}
-	return []byte(got), nil
-}
-
 // GetStatuses lists the statuses of a repository at the specified reference.
 func (ref *GithubRef) GetStatuses(client *github.Client) ([]*github.RepoStatus, error) {
 	statuses, _, err := client.Repositories.ListStatuses(context.Background(), ref.owner, ref.repo, ref.Sha, nil)
@@ -137,33 +127,25 @@ func (ref *GithubRef) GetStatuses(client *github.Client) ([]*github.RepoStatus,
 }
 
 // UpdateState creates the status
-func (ref *GithubRef) UpdateState(client *github.Client, ctx, state, targetURL, description string) error {
-	input := &github.RepoStatus{
-		Context:     github.String(ctx),
-		State:       github.String(state),
-		TargetURL:   github.String(targetURL),
-		Description: github.String(description),
-	}
-	_, _, err := client.Repositories.CreateStatus(context.Background(), ref.owner, ref.repo, ref.Sha, input)
+func (ref *GithubRef) UpdateState(f forge.Forge, ctx, state, targetURL, description string) error {
+	err := f.CreateStatus(context.Background(), ref.owner, ref.repo, ref.Sha, &forge.Status{
+		Context:     ctx,
+		State:       state,
+		TargetURL:   targetURL,
+		Description: description,
+	})
 	if err != nil {
-		LogError.Errorf("Repositories.CreateStatus returned error: %v", err)
+		LogError.Errorf("%s: create status returned error: %v", f.Name(), err)
 		return err
 	}
 	return nil
 }
 
 // CreateReview creates a new review on the specified pull request.
-func (ref *GithubRef) CreateReview(client *github.Client, prNum int, event, body string, comments []*github.DraftReviewComment) error {
-	input := &github.PullRequestReviewRequest{
-		CommitID: github.String(ref.Sha),
-		Body:     github.String(body),
-		Event:    github.String(event),
-		Comments: comments,
-	}
-
-	_, _, err := client.PullRequests.CreateReview(context.Background(), ref.owner, ref.repo, prNum, input)
+func (ref *GithubRef) CreateReview(f forge.Forge, prNum int, event, body string) error {
+	err := f.CreateReview(context.Background(), ref.owner, ref.repo, prNum, ref.Sha, event, body)
 	if err != nil {
-		LogError.Errorf("PullRequests.CreateReview returned error: %v", err)
+		LogError.Errorf("%s: create review returned error: %v", f.Name(), err)
 		return err
 	}
 	return nil
@@ -277,6 +259,11 @@ func badgesHandler(c *gin.Context) {
 }
 
 func webhookHandler(c *gin.Context) {
+	if c.GetHeader(giteaforge.HeaderEvent) != "" {
+		// Gitea sends the GitHub headers as well
+		giteaWebhookHandler(c)
+		return
+	}
 	hook, err := githubhook.Parse([]byte(Conf.GitHub.Secret), c.Request)
 
 	if err != nil {
@@ -287,6 +274,57 @@ func webhookHandler(c *gin.Context) {
 
 	LogAccess.Debugf("%s", hook.Payload)
 
+	if hook.Id != "" {
+		delivery := &store.Delivery{
+			ID:      hook.Id,
+			Event:   hook.Event,
+			Action:  hookAction(hook),
+			Payload: hook.Payload,
+		}
+		saved, err := delivery.Save()
+		if err != nil {
+			LogError.Errorf("Save delivery error: %v", err)
+			// PASS
+		} else if !saved {
+			LogAccess.Info("Ignore duplicate delivery: " + hook.Id)
+			c.JSON(http.StatusOK, gin.H{
+				"code": 0,
+				"info": "duplicate delivery: " + hook.Id,
+			})
+			return
+		} else {
+			defer func() {
+				if c.Writer.Status() >= http.StatusInternalServerError {
+					// keep the delivery if its message is queued, so that the
+					// redelivery does not queue it again
+					if d, err := store.LoadDelivery(delivery.ID); err == nil && d != nil && d.JobID != "" {
+						return
+					}
+					// accept the redelivery
+					err := delivery.Delete()
+					if err != nil {
+						LogError.Errorf("Delete delivery error: %v", err)
+					}
+				}
+			}()
+		}
+	}
+
+	handleHook(c, hook)
+}
+
+// hookAction returns the action of webhook payload, if any
+func hookAction(hook *githubhook.Hook) string {
+	var payload struct {
+		Action string `json:"action"`
+	}
+	_ = hook.Extract(&payload)
+	return payload.Action
+}
+
+// handleHook handles a verified webhook delivery
+func handleHook(c *gin.Context, hook *githubhook.Hook) {
+	var err error
 	if hook.Event == "ping" {
 		// pass
 		c.JSON(http.StatusOK, gin.H{
@@ -300,37 +338,53 @@ func webhookHandler(c *gin.Context) {
 			abortWithError(c, 400, "payload error: "+err.Error())
 			return
 		}
-		if payload.Action != "open" && payload.Action != "synchronize" {
+		switch payload.Action {
+		case "opened", "reopened", "synchronize", "ready_for_review":
+		default:
 			c.JSON(http.StatusOK, gin.H{
 				"code": 0,
 				"info": "no need to handle the action: " + payload.Action,
 			})
 			return
 		}
-		// opend or synchronized
-		message := fmt.Sprintf("%s/pull/%d/commits/%s",
-			payload.Repository.FullName,
-			payload.PullRequest.Number,
-			payload.PullRequest.Head.Sha,
-		)
-		LogAccess.WithField("entry", "webhook").Info("Push message: " + message)
+		if payload.PullRequest.Draft && skipDraft(forge.GitHub, payload.Repository.Owner.Login, payload.Repository.Name) {
+			c.JSON(http.StatusOK, gin.H{
+				"code": 0,
+				"info": "skip draft pull request",
+			})
+			return
+		}
+		// opened, reopened, synchronized or ready for review
+		message := mq.NewPullMessage(payload.Repository.Owner.Login, payload.Repository.Name,
+			int(payload.PullRequest.Number), payload.PullRequest.Head.Sha)
+		message.Event = hook.Event + "." + payload.Action
+		message.DeliveryID = hook.Id
+		LogAccess.WithField("entry", "webhook").Info("Push message: " + message.String())
 		ref := GithubRef{
 			owner: payload.Repository.Owner.Login,
 			repo:  payload.Repository.Name,
 
 			Sha: payload.PullRequest.Head.Sha,
 		}
-		err = MQ.Push(message)
+		client, err := getDefaultAPIClient(payload.Repository.Owner.Login)
 		if err != nil {
+			LogAccess.Errorf("getDefaultAPIClient returns error: %v", err)
+			abortWithError(c, 500, "getDefaultAPIClient returns error")
+			return
+		}
+		// the deliveries may arrive out of order or be replayed
+		gpull, err := GetGithubPull(context.Background(), client, ref.owner, ref.repo, message.PRNum)
+		if err != nil {
+			abortWithError(c, 500, "get pull request error")
+			return
+		}
+		err = pushHeadMessage(message, gpull.GetHead().GetSHA())
+		if err == ErrNotPullHead {
+			skipNotPullHead(c, message)
+		} else if err != nil {
 			LogAccess.Error("Add message to queue error: " + err.Error())
 			abortWithError(c, 500, "add to queue error: "+err.Error())
 		} else {
-			client, err := getDefaultAPIClient(payload.Repository.Owner.Login)
-			if err != nil {
-				LogAccess.Errorf("getDefaultAPIClient returns error: %v", err)
-				abortWithError(c, 500, "getDefaultAPIClient returns error")
-				return
-			}
 			markAsPending(client, ref)
 			c.JSON(http.StatusOK, gin.H{
 				"code": 0,
@@ -374,20 +428,28 @@ func webhookHandler(c *gin.Context) {
 			}
 		}
 
-		message := fmt.Sprintf("%s/pull/%d/commits/%s",
-			payload.Repository.FullName,
-			prNum,
-			*payload.CheckRun.HeadSHA,
-		)
-		LogAccess.WithField("entry", "webhook").Info("Push message: " + message)
+		message := mq.NewPullMessage(payload.Repository.Owner.Login, payload.Repository.Name,
+			prNum, *payload.CheckRun.HeadSHA)
+		message.Event = hook.Event + "." + payload.Action
+		message.Priority = mq.PriorityRerun
+		message.DeliveryID = hook.Id
+		LogAccess.WithField("entry", "webhook").Info("Push message: " + message.String())
 		ref := GithubRef{
 			owner: payload.Repository.Owner.Login,
 			repo:  payload.Repository.Name,
 
 			Sha: *payload.CheckRun.HeadSHA,
 		}
-		err = MQ.Push(message)
+		// the check run of an older commit may be rerequested
+		gpull, err := GetGithubPull(context.Background(), client, ref.owner, ref.repo, prNum)
 		if err != nil {
+			abortWithError(c, 500, "get pull request error")
+			return
+		}
+		err = pushHeadMessage(message, gpull.GetHead().GetSHA())
+		if err == ErrNotPullHead {
+			skipNotPullHead(c, message)
+		} else if err != nil {
 			LogAccess.Error("Add message to queue error: " + err.Error())
 			abortWithError(c, 500, "add to queue error: "+err.Error())
 		} else {
@@ -397,6 +459,12 @@ func webhookHandler(c *gin.Context) {
 				"info": "add to queue successfully",
 			})
 		}
+	} else if hook.Event == "push" {
+		pushEventHandler(c, hook)
+	} else if hook.Event == "issue_comment" {
+		issueCommentHandler(c, hook)
+	} else if hook.Event == "installation" || hook.Event == "installation_repositories" {
+		installationEventHandler(c, hook)
 	} else {
 		abortWithError(c, 415, "unsupported event: "+hook.Event)
 	}
@@ -443,7 +511,7 @@ func HasLintStatuses(client *github.Client, ref *GithubRef) (bool, error) {
 }
 
 // TODO: add test
-func needPRChecking(client *github.Client, ref *GithubRef, message string, MQ mq.MessageQueue) (bool, error) {
+func needPRChecking(client *github.Client, ref *GithubRef, message *mq.Message, MQ mq.MessageQueue) (bool, error) {
 	statuses, err := ref.GetStatuses(client)
 	if err != nil {
 		err = fmt.Errorf("github get statuses failed: %v", err)
@@ -540,61 +608,19 @@ func WatchLocalRepo(ctx context.Context) error {
 					}
 					if isDir {
 						owner, repo := file.Name(), subfile.Name()
+						if err := waitForRateLimit(ctx, owner); err != nil {
+							LogAccess.Warn("WatchLocalRepo canceled.")
+							return nil
+						}
 						projConf, err := readProjectConfig(filepath.Join(path, subfile.Name()))
 						if err == nil && len(projConf.Tests) > 0 {
-							masterBranch, _, err := client.Repositories.GetBranch(ctx, owner, repo, "master")
+							branches, err := listCheckedBranches(ctx, client, owner, repo)
 							if err != nil {
-								LogError.Errorf("WatchLocalRepo:GetBranch for master error: %v", err)
+								LogError.Errorf("WatchLocalRepo:ListCheckedBranches error: %v", err)
 								// PASS
-							} else {
-								// check master commit status
-								masterCommitSHA := *masterBranch.Commit.SHA
-								commitInfos, err := store.ListCommitsInfo(owner, repo, masterCommitSHA)
-								if err != nil {
-									LogError.Errorf("WatchLocalRepo:LoadCommitsInfo for master error: %v", err)
-									// PASS
-								} else if len(commitInfos) >= len(projConf.Tests) {
-									// promote status
-									updated := false
-									for _, commitInfo := range commitInfos {
-										if commitInfo.Status == 0 {
-											err = commitInfo.UpdateStatus(1)
-											if err != nil {
-												LogError.Errorf("WatchLocalRepo:CommitInfo:UpdateStatus error: %v", err)
-												// PASS
-											} else {
-												updated = true
-											}
-										}
-									}
-									if updated {
-										LogAccess.Infof("CommitInfo %s/%s %s for master status updated", owner, repo, masterCommitSHA)
-									}
-								} else {
-									ref := GithubRef{
-										owner: owner,
-										repo:  repo,
-
-										Sha: masterCommitSHA,
-									}
-									message := fmt.Sprintf("%s/%s/tree/%s/commits/%s", ref.owner, ref.repo, "master", masterCommitSHA)
-									needCheck, err := needPRChecking(client, &ref, message, MQ)
-									if err != nil {
-										LogError.Errorf("WatchLocalRepo:NeedPRChecking for master error: %v", err)
-										continue
-									}
-									if needCheck {
-										// no statuses, need check
-										LogAccess.WithField("entry", "local").Info("Push message: " + message)
-										err = MQ.Push(message)
-										if err == nil {
-											markAsPending(client, ref)
-										} else {
-											LogAccess.Error("Add message to queue error: " + err.Error())
-											// PASS
-										}
-									}
-								}
+							}
+							for _, branch := range branches {
+								watchBranch(client, owner, repo, branch.GetName(), branch.GetCommit().GetSHA(), len(projConf.Tests))
 							}
 						}
 						pulls, err := GetGithubPulls(ctx, client, owner, repo)
@@ -609,13 +635,17 @@ func WatchLocalRepo(ctx context.Context) error {
 								return nil
 							default:
 							}
+							if pull.GetDraft() && projConf.SkipDraft {
+								continue
+							}
 							ref := GithubRef{
 								owner: owner,
 								repo:  repo,
 
 								Sha: pull.GetHead().GetSHA(),
 							}
-							message := fmt.Sprintf("%s/%s/pull/%d/commits/%s", ref.owner, ref.repo, pull.GetNumber(), ref.Sha)
+							message := mq.NewPullMessage(ref.owner, ref.repo, pull.GetNumber(), ref.Sha)
+							message.Event = "watch"
 							needCheck, err := needPRChecking(client, &ref, message, MQ)
 							if err != nil {
 								LogError.Errorf("WatchLocalRepo:NeedPRChecking error: %v", err)
@@ -623,8 +653,8 @@ func WatchLocalRepo(ctx context.Context) error {
 							}
 							if needCheck {
 								// no statuses, need check
-								LogAccess.WithField("entry", "local").Info("Push message: " + message)
-								err = MQ.Push(message)
+								LogAccess.WithField("entry", "local").Info("Push message: " + message.String())
+								err = pushMessage(message)
 								if err == nil {
 									markAsPending(client, ref)
 								} else {
@@ -650,11 +680,16 @@ func WatchLocalRepo(ctx context.Context) error {
 }
 
 func markAsPending(client *github.Client, ref GithubRef) {
+	markForgeAsPending(&githubforge.Forge{Client: client}, ref)
+}
+
+// markForgeAsPending marks the commit as queueing on forge
+func markForgeAsPending(f forge.Forge, ref GithubRef) {
 	targetURL := ""
 	if len(Conf.Core.CheckLogURI) > 0 {
-		targetURL = Conf.Core.CheckLogURI + ref.owner + "/" + ref.repo + "/" + ref.Sha + ".log"
+		targetURL = Conf.Core.CheckLogURI + repositoryPath(f.Name(), ref.owner, ref.repo) + "/" + ref.Sha + ".log"
 	}
-	err := ref.UpdateState(client, AppName, "pending", targetURL,
+	err := ref.UpdateState(f, AppName, forge.StatePending, targetURL,
 		"check queueing")
 	if err != nil {
 		LogAccess.Error("Update pull request status error: " + err.Error())
@@ -679,7 +714,7 @@ var sizeLabels = []*SizeLabel{
 }
 
 // LabelPRSize creates and labels PR with its size
-func LabelPRSize(ctx context.Context, client *github.Client, ref GithubRef, prNum int, diffs []*diff.FileDiff) error {
+func LabelPRSize(ctx context.Context, f forge.Forge, ref GithubRef, prNum int, diffs []*diff.FileDiff) error {
 	lines := 0
 	for _, d := range diffs {
 		for _, h := range d.Hunks {
@@ -698,33 +733,26 @@ func LabelPRSize(ctx context.Context, client *github.Client, ref GithubRef, prNu
 		}
 	}
 
-	opts := &github.ListOptions{}
 	var labelsToBeRemoved []string
 	hasExpectedLabel := false
 	// check whether exists
-	for {
-		ls, resp, err := client.Issues.ListLabelsByIssue(ctx, ref.owner, ref.repo, prNum, opts)
-		if err != nil {
-			return err
-		}
-		for _, l := range ls {
-			if strings.HasPrefix(*l.Name, "size/") {
-				// already exists
-				if sizeLabel.Name == *l.Name {
-					hasExpectedLabel = true
-				} else {
-					labelsToBeRemoved = append(labelsToBeRemoved, *l.Name)
-				}
+	ls, err := f.ListLabels(ctx, ref.owner, ref.repo, prNum)
+	if err != nil {
+		return err
+	}
+	for _, l := range ls {
+		if strings.HasPrefix(l, "size/") {
+			// already exists
+			if sizeLabel.Name == l {
+				hasExpectedLabel = true
+			} else {
+				labelsToBeRemoved = append(labelsToBeRemoved, l)
 			}
 		}
-		if resp.NextPage == 0 {
-			break
-		}
-		opts.Page = resp.NextPage
 	}
 
 	for _, s := range labelsToBeRemoved {
-		_, err := client.Issues.RemoveLabelForIssue(ctx, ref.owner, ref.repo, prNum, s)
+		err := f.RemoveLabel(ctx, ref.owner, ref.repo, prNum, s)
 		if err != nil {
 			LogError.Errorf("remove label %s error: %v", s, err)
 			// PASS
@@ -734,20 +762,9 @@ func LabelPRSize(ctx context.Context, client *github.Client, ref GithubRef, prNu
 		return nil
 	}
 
-	labels, _, err := client.Issues.AddLabelsToIssue(ctx, ref.owner, ref.repo, prNum, []string{sizeLabel.Name})
-	for _, l := range labels {
-		if *l.Name == sizeLabel.Name {
-			if l.Color == nil || l.Description == nil || *l.Color != sizeLabel.Color || *l.Description != sizeLabel.Description {
-				l.Color = &sizeLabel.Color
-				l.Description = &sizeLabel.Description
-				_, _, err2 := client.Issues.EditLabel(ctx, ref.owner, ref.repo, *l.Name, l)
-				if err2 != nil {
-					LogError.Errorf("edit label error: %v", err2)
-					// PASS
-				}
-			}
-			break
-		}
-	}
-	return err
+	return f.AddLabel(ctx, ref.owner, ref.repo, prNum, &forge.Label{
+		Name:        sizeLabel.Name,
+		Color:       sizeLabel.Color,
+		Description: sizeLabel.Description,
+	})
 }
@@ -2,12 +2,16 @@ package checker
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/bradleyfalzon/ghinstallation"
@@ -17,9 +21,25 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/tengattack/unified-ci/config"
+	githubforge "github.com/tengattack/unified-ci/forge/github"
 	"github.com/tengattack/unified-ci/store"
 )
 
+// testStoreFile is the database of store shared by tests
+const testStoreFile = "file name.db"
+
+// useTestStore switches store to an empty database of file, the returned
+// function restores the shared one
+func useTestStore(t *testing.T, file string) func() {
+	store.Deinit()
+	require.NoError(t, store.Init(file))
+	return func() {
+		store.Deinit()
+		os.Remove(file)
+		require.NoError(t, store.Init(testStoreFile))
+	}
+}
+
 func TestMain(m *testing.M) {
 	Conf = config.BuildDefaultConf()
 	err := InitLog(Conf)
@@ -27,8 +47,7 @@ func TestMain(m *testing.M) {
 		panic(err)
 	}
 
-	fileDB := "file name.db"
-	err = store.Init(fileDB)
+	err = store.Init(testStoreFile)
 	if err != nil {
 		panic(err)
 	}
@@ -39,7 +58,7 @@ func TestMain(m *testing.M) {
 
 	// clean up
 	store.Deinit()
-	os.Remove(fileDB)
+	os.Remove(testStoreFile)
 
 	os.Exit(code)
 }
@@ -73,8 +92,9 @@ func TestLabelPRSize(t *testing.T) {
 
 	ctx := context.Background()
 	ref := GithubRef{owner: "tengattack", repo: "playground"}
+	f := &githubforge.Forge{Client: client}
 
-	err = LabelPRSize(ctx, client, ref, 1, diffs)
+	err = LabelPRSize(ctx, f, ref, 1, diffs)
 	assert.NoError(err)
 
 	testDiffFile = path.Join(currentDir, "../testdata/test1.go.diff")
@@ -83,7 +103,7 @@ func TestLabelPRSize(t *testing.T) {
 
 	diffs, err = diff.ParseMultiFileDiff(out)
 	require.NoError(err)
-	err = LabelPRSize(ctx, client, ref, 1, diffs)
+	err = LabelPRSize(ctx, f, ref, 1, diffs)
 	assert.NoError(err)
 
 	// TODO: check more conditions
@@ -162,3 +182,58 @@ func TestBadgesHandler(t *testing.T) {
 	assert.Contains(resp.Body.String(), ">build<")
 	assert.Contains(resp.Body.String(), ">passing<") // round to integer
 }
+
+func TestWebhookDeliveries(t *testing.T) {
+	assert := assert.New(t)
+
+	secret, token := Conf.GitHub.Secret, Conf.API.AdminToken
+	defer func() { Conf.GitHub.Secret, Conf.API.AdminToken = secret, token }()
+	Conf.GitHub.Secret = "secret"
+	Conf.API.AdminToken = "admin"
+
+	_, r := gin.CreateTestContext(httptest.NewRecorder())
+	r.POST("/api/webhook", webhookHandler)
+	admin := r.Group("/api/admin", AdminMiddleware())
+	admin.GET("/deliveries/:id", adminDeliveryHandler)
+	admin.POST("/deliveries/:id/replay", adminReplayHandler)
+
+	payload := `{"zen":"Keep it logically awesome."}`
+	mac := hmac.New(sha1.New, []byte(Conf.GitHub.Secret))
+	mac.Write([]byte(payload))
+	deliver := func() *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/webhook", strings.NewReader(payload))
+		req.Header.Set("X-GitHub-Event", "ping")
+		req.Header.Set("X-GitHub-Delivery", "delivery-1")
+		req.Header.Set("X-Hub-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := deliver()
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), "Welcome")
+	resp = deliver()
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), "duplicate delivery")
+
+	resp = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/deliveries/delivery-1", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	r.ServeHTTP(resp, req)
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), store.HashPayload([]byte(payload)))
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/api/admin/deliveries/delivery-1/replay", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	r.ServeHTTP(resp, req)
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), "Welcome")
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/api/admin/deliveries/unknown/replay", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	r.ServeHTTP(resp, req)
+	assert.Equal(http.StatusNotFound, resp.Code)
+}
@@ -0,0 +1,110 @@
+package checker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tengattack/unified-ci/forge"
+	gitlabforge "github.com/tengattack/unified-ci/forge/gitlab"
+	"github.com/tengattack/unified-ci/mq"
+)
+
+func gitlabWebhookHandler(c *gin.Context) {
+	if !Conf.GitLab.Enabled {
+		abortWithError(c, 404, "GitLab is not enabled")
+		return
+	}
+	if !gitlabforge.VerifyToken(c.Request, Conf.GitLab.Secret) {
+		LogAccess.Error("Check GitLab token error")
+		abortWithError(c, 403, "check token error")
+		return
+	}
+
+	payload, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		abortWithError(c, 400, "read payload error: "+err.Error())
+		return
+	}
+	LogAccess.Debugf("%s", payload)
+
+	event := c.GetHeader(gitlabforge.HeaderEvent)
+	switch event {
+	case gitlabforge.EventMergeRequest:
+		gitlabMergeRequestHandler(c, payload)
+	default:
+		abortWithError(c, 415, "unsupported event: "+event)
+	}
+}
+
+func gitlabMergeRequestHandler(c *gin.Context, data []byte) {
+	var payload gitlabforge.MergeRequestEvent
+	err := json.Unmarshal(data, &payload)
+	if err != nil {
+		abortWithError(c, 400, "payload error: "+err.Error())
+		return
+	}
+	mr := payload.ObjectAttributes
+	switch mr.Action {
+	case "open", "reopen":
+	case "update":
+		if mr.Oldrev == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"code": 0,
+				"info": "no new commits are pushed",
+			})
+			return
+		}
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"info": "no need to handle the action: " + mr.Action,
+		})
+		return
+	}
+	owner, repo := gitlabforge.SplitPath(payload.Project.PathWithNamespace)
+	if owner == "" || mr.IID <= 0 || mr.LastCommit.ID == "" {
+		abortWithError(c, 400, "payload error: missing project, iid or last commit")
+		return
+	}
+	if (mr.Draft || mr.WorkInProgress) && skipDraft(forge.GitLab, owner, repo) {
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"info": "skip draft merge request",
+		})
+		return
+	}
+
+	message := mq.NewPullMessage(owner, repo, mr.IID, mr.LastCommit.ID)
+	message.Forge = forge.GitLab
+	message.Event = "merge_request." + mr.Action
+	LogAccess.WithField("entry", "gitlab").Info("Push message: " + message.String())
+	f, err := getForge(forge.GitLab, owner)
+	if err != nil {
+		abortWithError(c, 500, "create forge client error: "+err.Error())
+		return
+	}
+	// the deliveries may arrive out of order
+	pull, err := f.GetPullRequest(c.Request.Context(), owner, repo, mr.IID)
+	if err != nil {
+		LogAccess.Errorf("GetPullRequest error: %v", err)
+		abortWithError(c, 500, "get pull request error")
+		return
+	}
+	err = pushHeadMessage(message, pull.HeadSHA)
+	if err == ErrNotPullHead {
+		skipNotPullHead(c, message)
+		return
+	}
+	if err != nil {
+		LogAccess.Error("Add message to queue error: " + err.Error())
+		abortWithError(c, 500, "add to queue error: "+err.Error())
+		return
+	}
+	markForgeAsPending(f, GithubRef{owner: owner, repo: repo, Sha: mr.LastCommit.ID})
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"info": "add to queue successfully",
+	})
+}
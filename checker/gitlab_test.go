@@ -0,0 +1,94 @@
+package checker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tengattack/unified-ci/forge"
+	gitlabforge "github.com/tengattack/unified-ci/forge/gitlab"
+	"github.com/tengattack/unified-ci/mq"
+	"github.com/tengattack/unified-ci/mq/sqlite"
+)
+
+func TestGitLabWebhook(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	gitlab := Conf.GitLab
+	defer func() { Conf.GitLab = gitlab }()
+
+	var statuses []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"iid":3,"state":"opened","sha":"sha"}`))
+			return
+		}
+		statuses = append(statuses, r.URL.EscapedPath())
+		w.WriteHeader(http.StatusCreated)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	Conf.GitLab.Enabled = true
+	Conf.GitLab.BaseURL = server.URL + "/api/v4/"
+	Conf.GitLab.Token = "token"
+	Conf.GitLab.Secret = "secret"
+
+	fileDB := "gitlab test.db"
+	q := sqlite.New(sqlite.Config{File: fileDB})
+	require.NoError(q.Init())
+	defer os.Remove(fileDB)
+	defer q.Deinit()
+	MQ = q
+	defer func() { MQ = nil }()
+
+	_, r := gin.CreateTestContext(httptest.NewRecorder())
+	r.POST("/api/gitlab/webhook", gitlabWebhookHandler)
+	send := func(token, event, payload string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/gitlab/webhook", strings.NewReader(payload))
+		req.Header.Set(gitlabforge.HeaderToken, token)
+		req.Header.Set(gitlabforge.HeaderEvent, event)
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+	payload := func(action, oldrev string) string {
+		return `{"object_kind":"merge_request","project":{"path_with_namespace":"group/sub/repo"},` +
+			`"object_attributes":{"iid":3,"action":"` + action + `","oldrev":"` + oldrev + `","last_commit":{"id":"sha"}}}`
+	}
+
+	assert.Equal(http.StatusForbidden, send("wrong", gitlabforge.EventMergeRequest, payload("open", "")).Code)
+	assert.Equal(http.StatusUnsupportedMediaType, send("secret", "Push Hook", `{}`).Code)
+	assert.Equal(http.StatusBadRequest, send("secret", gitlabforge.EventMergeRequest, `{"object_attributes":{"action":"open"}}`).Code)
+
+	resp := send("secret", gitlabforge.EventMergeRequest, payload("update", ""))
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), "no new commits")
+	resp = send("secret", gitlabforge.EventMergeRequest, payload("merge", ""))
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), "no need to handle")
+	entries, err := MQ.List(mq.ChannelQueue)
+	require.NoError(err)
+	assert.Empty(entries)
+
+	resp = send("secret", gitlabforge.EventMergeRequest, payload("update", "old"))
+	assert.Equal(http.StatusOK, resp.Code)
+	entries, err = MQ.List(mq.ChannelQueue)
+	require.NoError(err)
+	require.Len(entries, 1)
+	m := entries[0].Message
+	assert.Equal(forge.GitLab, m.Forge)
+	assert.Equal("group/sub", m.Owner)
+	assert.Equal("repo", m.Repo)
+	assert.Equal(3, m.PRNum)
+	assert.Equal("sha", m.Sha)
+	assert.Equal("merge_request.update", m.Event)
+	// marked as pending
+	assert.Equal([]string{"/api/v4/projects/group%2Fsub%2Frepo/statuses/sha"}, statuses)
+}
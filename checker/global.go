@@ -17,6 +17,11 @@ var (
 
 	// MQ is the message queue
 	MQ mq.MessageQueue
+	// WorkerID identifies this process as the owner of message leases
+	WorkerID string
+	// WorkerOnly means this process only processes messages from the queue,
+	// its jobs are reported through MQ and recorded by the server
+	WorkerOnly bool
 )
 
 var userAgent string
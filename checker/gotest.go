@@ -12,8 +12,8 @@ import (
 	"sync"
 	"time"
 
-	"github.com/google/go-github/github"
 	shellwords "github.com/mattn/go-shellwords"
+	"github.com/tengattack/unified-ci/forge"
 	"github.com/tengattack/unified-ci/store"
 	"github.com/tengattack/unified-ci/util"
 )
@@ -46,18 +46,26 @@ func carry(ctx context.Context, p *shellwords.Parser, repo, cmd string, log io.W
 	return cmds.Run()
 }
 
-// ReportTestResults reports the test results to github
-func ReportTestResults(testName string, repoPath string, cmds []string, coveragePattern string, client *github.Client, gpull *github.PullRequest,
+// ReportTestResults reports the test results to forge, pull is nil for
+// branches
+func ReportTestResults(ctx context.Context, testName string, repoPath string, cmds []string, coveragePattern string, f forge.Forge, pull *forge.PullRequest,
 	ref GithubRef, targetURL string, log io.Writer) (string, error) {
 	outputTitle := testName + " test"
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
 	defer cancel()
 
-	t := github.Timestamp{Time: time.Now()}
+	var (
+		prNum  int
+		author string
+	)
+	if pull != nil {
+		prNum = pull.Number
+		author = pull.Author
+	}
 
-	var checkRunID int64
+	var check *forge.Check
 	if ref.IsBranch() {
-		err := ref.UpdateState(client, outputTitle, "pending", targetURL, "running")
+		err := ref.UpdateState(f, outputTitle, forge.StatePending, targetURL, "running")
 		if err != nil {
 			msg := fmt.Sprintf("Update commit state %s failed: %v", outputTitle, err)
 			_, _ = io.WriteString(log, msg+"\n")
@@ -65,19 +73,24 @@ func ReportTestResults(testName string, repoPath string, cmds []string, coverage
 			// PASS
 		}
 	} else {
-		checkRun, err := CreateCheckRun(ctx, client, gpull, outputTitle, ref, targetURL)
+		var err error
+		check, err = CreateCheckRun(ctx, f, ref, prNum, outputTitle, targetURL)
 		if err != nil {
 			msg := fmt.Sprintf("Creating %s check run failed: %v", outputTitle, err)
 			_, _ = io.WriteString(log, msg+"\n")
 			LogError.Error(msg)
 			// PASS
-		} else {
-			checkRunID = checkRun.GetID()
 		}
 	}
 
 	conclusion, reportMessage, outputSummary := testAndSaveCoverage(ctx, ref, testName, cmds,
-		coveragePattern, repoPath, gpull, false, log)
+		coveragePattern, repoPath, author, false, log)
+	if conclusion == forge.ConclusionCancelled {
+		if check != nil {
+			UpdateCheckRunCancelled(f, ref, check)
+		}
+		return reportMessage, ctx.Err()
+	}
 
 	title := ""
 	if coveragePattern == "" {
@@ -86,11 +99,11 @@ func ReportTestResults(testName string, repoPath string, cmds []string, coverage
 		title = "coverage: " + reportMessage
 	}
 	if ref.IsBranch() {
-		state := "success"
-		if conclusion == "failure" {
-			state = "error"
+		state := forge.StateSuccess
+		if conclusion == forge.ConclusionFailure {
+			state = forge.StateError
 		}
-		err := ref.UpdateState(client, outputTitle, state, targetURL, title)
+		err := ref.UpdateState(f, outputTitle, state, targetURL, title)
 		if err != nil {
 			msg := fmt.Sprintf("Update commit state %s failed: %v", outputTitle, err)
 			_, _ = io.WriteString(log, msg+"\n")
@@ -98,28 +111,27 @@ func ReportTestResults(testName string, repoPath string, cmds []string, coverage
 			// PASS
 		}
 	} else {
-		if checkRunID == 0 {
+		if check == nil {
 			// create check run now if it failed before
-			checkRun, err := CreateCheckRun(ctx, client, gpull, outputTitle, ref, targetURL)
+			var err error
+			check, err = CreateCheckRun(ctx, f, ref, prNum, outputTitle, targetURL)
 			if err != nil {
 				msg := fmt.Sprintf("Creating %s check run failed: %v", outputTitle, err)
 				_, _ = io.WriteString(log, msg+"\n")
 				LogError.Error(msg)
 				// PASS
-			} else {
-				checkRunID = checkRun.GetID()
 			}
 		}
 
-		if checkRunID != 0 {
-			err := UpdateCheckRun(ctx, client, gpull, checkRunID, outputTitle, conclusion, t, title, "```\n"+outputSummary+"\n```", nil)
+		if check != nil {
+			err := UpdateCheckRun(ctx, f, ref, check, conclusion, title, "```\n"+outputSummary+"\n```", nil)
 			if err != nil {
-				LogError.Errorf("report test results to github failed: %v", err)
+				LogError.Errorf("report test results to %s failed: %v", f.Name(), err)
 				// PASS
 			}
 		}
 	}
-	if conclusion == "failure" {
+	if conclusion == forge.ConclusionFailure {
 		err := &testNotPass{Title: outputTitle}
 		return reportMessage, err
 	}
@@ -145,7 +157,7 @@ func parseCoverage(pattern, output string) (string, float64, error) {
 }
 
 func testAndSaveCoverage(ctx context.Context, ref GithubRef, testName string, cmds []string, coveragePattern string,
-	repoPath string, gpull *github.PullRequest, breakOnFails bool, log io.Writer) (conclusion, reportMessage, outputSummary string) {
+	repoPath string, author string, breakOnFails bool, log io.Writer) (conclusion, reportMessage, outputSummary string) {
 	parser := NewShellParser(repoPath, ref)
 
 	_, _ = io.WriteString(log, fmt.Sprintf("Testing '%s'\n", testName))
@@ -170,6 +182,12 @@ func testAndSaveCoverage(ctx context.Context, ref GithubRef, testName string, cm
 			}
 		}
 	}
+	if ctx.Err() == context.Canceled {
+		// the results of interrupted tests are not saved
+		_, _ = io.WriteString(log, "Test cancelled.\n")
+		conclusion = "cancelled"
+		return
+	}
 	// get test coverage even if the conclusion is failure when ignoring the failed tests
 	if coveragePattern != "" && (conclusion == "success" || !breakOnFails) {
 		percentage, pct, err := parseCoverage(coveragePattern, outputSummary)
@@ -184,7 +202,7 @@ func testAndSaveCoverage(ctx context.Context, ref GithubRef, testName string, cm
 				Owner:    ref.owner,
 				Repo:     ref.repo,
 				Sha:      ref.Sha,
-				Author:   gpull.GetHead().GetUser().GetLogin(),
+				Author:   author,
 				Test:     testName,
 				Coverage: &pct,
 			}
@@ -216,7 +234,7 @@ func testAndSaveCoverage(ctx context.Context, ref GithubRef, testName string, cm
 			Owner:    ref.owner,
 			Repo:     ref.repo,
 			Sha:      ref.Sha,
-			Author:   gpull.GetHead().GetUser().GetLogin(),
+			Author:   author,
 			Test:     testName,
 			Coverage: &pct,
 			Passing:  0,
@@ -85,11 +85,12 @@ func getLintsFromDiff(fileDiff *diff.FileDiff, lints []LintMessage, ruleID strin
 				size = 1
 			}
 			lints = append(lints, LintMessage{
-				RuleID:   ruleID,
-				Line:     int(hunk.OrigStartLine) + delta,
-				Column:   size,
-				Message:  "\n```diff\n" + string(hunk.Body) + "```",
-				Severity: severityLevelError,
+				RuleID:    ruleID,
+				Line:      int(hunk.OrigStartLine) + delta,
+				Column:    size,
+				Message:   "\n```diff\n" + string(hunk.Body) + "```",
+				Severity:  severityLevelError,
+				Formatted: true,
 			})
 		}
 	}
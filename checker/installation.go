@@ -0,0 +1,161 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-github/github"
+	"github.com/tengattack/unified-ci/store"
+	"github.com/tengattack/unified-ci/util"
+	githubhook "gopkg.in/rjz/githubhook.v0"
+)
+
+// GetInstallationID gets the installation ID of owner, github.installations in
+// config overrides the discovered installations, the installations unknown to
+// this process are looked up by GitHub App API
+func GetInstallationID(owner string) (int64, bool) {
+	if id, ok := Conf.GitHub.Installations[owner]; ok {
+		return id, true
+	}
+	i, err := store.LoadInstallation(owner)
+	if err != nil {
+		LogError.Errorf("LoadInstallation error: %v", err)
+		return 0, false
+	}
+	if i != nil {
+		return i.ID, true
+	}
+	installation, err := findInstallation(context.Background(), owner)
+	if err != nil {
+		LogError.Errorf("Find installation of %s error: %v", owner, err)
+		return 0, false
+	}
+	if installation == nil {
+		return 0, false
+	}
+	// cached until it is updated by the installation events
+	i = &store.Installation{Owner: owner, ID: installation.GetID()}
+	err = i.Save()
+	if err != nil {
+		LogError.Errorf("Save installation of %s error: %v", owner, err)
+		// PASS
+	}
+	return i.ID, true
+}
+
+// findInstallation looks up the installation of the organization or user
+// owner, e.g. its installation event is delivered to another process after
+// this worker has discovered the installations, nil is returned if the App is
+// not installed by owner
+func findInstallation(ctx context.Context, owner string) (*github.Installation, error) {
+	if util.JWTClient == nil {
+		return nil, nil
+	}
+	installation, _, err := util.JWTClient.Apps.FindOrganizationInstallation(ctx, owner)
+	if isNotFound(err) {
+		installation, _, err = util.JWTClient.Apps.FindUserInstallation(ctx, owner)
+	}
+	if isNotFound(err) {
+		return nil, nil
+	}
+	return installation, err
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*github.ErrorResponse)
+	return ok && e.Response != nil && e.Response.StatusCode == http.StatusNotFound
+}
+
+// waitForRateLimit delays non-urgent work of owner until the quota is reset if
+// the remaining quota is low
+func waitForRateLimit(ctx context.Context, owner string) error {
+	installationID, ok := GetInstallationID(owner)
+	if !ok {
+		return nil
+	}
+	remaining, reset, ok := util.InstallationRateLimit(installationID)
+	if !ok || remaining >= Conf.GitHub.RateLimitThreshold || !time.Now().Before(reset) {
+		return nil
+	}
+	LogAccess.Warnf("Rate limit of %s is low (%d remaining), wait until %s",
+		owner, remaining, reset.Format(time.RFC3339))
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(reset)):
+	}
+	return nil
+}
+
+// DiscoverInstallations saves all installations of the GitHub App
+func DiscoverInstallations(ctx context.Context) error {
+	opt := &github.ListOptions{PerPage: 100}
+	count := 0
+	for {
+		installations, resp, err := util.JWTClient.Apps.ListInstallations(ctx, opt)
+		if err != nil {
+			return err
+		}
+		for _, installation := range installations {
+			err = saveInstallation(installation)
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	LogAccess.Infof("Discovered %d installation(s)", count)
+	return nil
+}
+
+func saveInstallation(installation *github.Installation) error {
+	i := &store.Installation{
+		Owner: installation.GetAccount().GetLogin(),
+		ID:    installation.GetID(),
+	}
+	return i.Save()
+}
+
+func deleteInstallation(installation *github.Installation) error {
+	i := &store.Installation{Owner: installation.GetAccount().GetLogin()}
+	return i.Delete()
+}
+
+// installationEventHandler keeps the installations up to date by the
+// installation and installation_repositories events
+func installationEventHandler(c *gin.Context, hook *githubhook.Hook) {
+	var payload struct {
+		Action       string               `json:"action"`
+		Installation *github.Installation `json:"installation"`
+	}
+	err := hook.Extract(&payload)
+	if err != nil || payload.Installation == nil {
+		abortWithError(c, 400, "payload error")
+		return
+	}
+	owner := payload.Installation.GetAccount().GetLogin()
+	switch payload.Action {
+	case "deleted", "suspend":
+		LogAccess.Infof("Remove installation %d of %s", payload.Installation.GetID(), owner)
+		err = deleteInstallation(payload.Installation)
+	default:
+		// created, unsuspend, new_permissions_accepted, added or removed
+		LogAccess.Infof("Save installation %d of %s", payload.Installation.GetID(), owner)
+		err = saveInstallation(payload.Installation)
+	}
+	if err != nil {
+		LogError.Errorf("Update installation error: %v", err)
+		abortWithError(c, 500, "update installation error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"info": "installation updated",
+	})
+}
@@ -0,0 +1,98 @@
+package checker
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tengattack/unified-ci/store"
+	"github.com/tengattack/unified-ci/util"
+	githubhook "gopkg.in/rjz/githubhook.v0"
+)
+
+func TestInstallations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	installations := Conf.GitHub.Installations
+	defer func() { Conf.GitHub.Installations = installations }()
+	Conf.GitHub.Installations = map[string]int64{"override": 1}
+
+	handle := func(event, payload string) int {
+		resp := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(resp)
+		installationEventHandler(c, &githubhook.Hook{Event: event, Payload: []byte(payload)})
+		return resp.Code
+	}
+	assert.Equal(http.StatusOK, handle("installation",
+		`{"action":"created","installation":{"id":2,"account":{"login":"org"}}}`))
+	assert.Equal(http.StatusOK, handle("installation",
+		`{"action":"created","installation":{"id":3,"account":{"login":"override"}}}`))
+
+	id, ok := GetInstallationID("org")
+	assert.True(ok)
+	assert.EqualValues(2, id)
+	id, ok = GetInstallationID("override")
+	assert.True(ok)
+	assert.EqualValues(1, id)
+
+	assert.Equal(http.StatusOK, handle("installation",
+		`{"action":"deleted","installation":{"id":2,"account":{"login":"org"}}}`))
+	_, ok = GetInstallationID("org")
+	assert.False(ok)
+
+	assert.Equal(http.StatusOK, handle("installation_repositories",
+		`{"action":"added","installation":{"id":2,"account":{"login":"org"}}}`))
+	i, err := store.LoadInstallation("org")
+	require.NoError(err)
+	require.NotNil(i)
+	assert.EqualValues(2, i.ID)
+
+	assert.Equal(http.StatusBadRequest, handle("installation", `{"action":"created"}`))
+}
+
+func TestFindInstallation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	defer useTestStore(t, "installations test.db")()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/org/installation", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":4,"account":{"login":"org"}}`)
+	})
+	mux.HandleFunc("/users/user/installation", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":5,"account":{"login":"user"}}`)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message":"Not Found"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := util.JWTClient
+	defer func() { util.JWTClient = client }()
+	util.JWTClient = github.NewClient(nil)
+	util.JWTClient.BaseURL, _ = url.Parse(server.URL + "/")
+
+	// installed after the installations are discovered by this process
+	id, ok := GetInstallationID("org")
+	assert.True(ok)
+	assert.EqualValues(4, id)
+	id, ok = GetInstallationID("user")
+	assert.True(ok)
+	assert.EqualValues(5, id)
+	_, ok = GetInstallationID("unknown")
+	assert.False(ok)
+
+	// cached
+	i, err := store.LoadInstallation("user")
+	require.NoError(err)
+	require.NotNil(i)
+	assert.EqualValues(5, i.ID)
+}
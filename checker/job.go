@@ -0,0 +1,263 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tengattack/unified-ci/forge"
+	"github.com/tengattack/unified-ci/mq"
+	"github.com/tengattack/unified-ci/store"
+)
+
+// syncJobsInterval is how often the server records the jobs reported by
+// workers
+var syncJobsInterval = 5 * time.Second
+
+// syncJobsBatch is the number of reports popped at a time
+const syncJobsBatch = 100
+
+// Job conclusions besides the check run conclusions
+const (
+	JobSuperseded = "superseded"
+	JobSkipped    = "skipped"
+	// JobDropped means the message is removed from queue by admin
+	JobDropped = "dropped"
+)
+
+func newJob(message *mq.Message) *store.Job {
+	return &store.Job{
+		ID:     message.ID,
+		Forge:  jobForge(message.Forge),
+		Owner:  message.Owner,
+		Repo:   message.Repo,
+		PRNum:  message.PRNum,
+		Branch: message.Branch,
+		Sha:    message.Sha,
+		Event:  message.Event,
+		Status: store.JobQueued,
+	}
+}
+
+// jobForge returns the forge of job, the messages of GitHub have no forge
+func jobForge(name string) string {
+	if name == "" {
+		return forge.GitHub
+	}
+	return name
+}
+
+// pushMessage adds message to queue and records it as a queued job of its
+// delivery
+func pushMessage(message *mq.Message) error {
+	err := MQ.Push(message)
+	if err != nil {
+		return err
+	}
+	if message.ID == "" {
+		return nil
+	}
+	err = newJob(message).Save()
+	if err != nil {
+		LogError.Errorf("Save job %s error: %v", message.ID, err)
+		// PASS
+	}
+	if message.Type == mq.TypePull {
+		// the queued messages of older commits are dropped by push
+		_, err = store.FinishQueuedPullJobs(jobForge(message.Forge), message.Owner, message.Repo, message.PRNum, message.Sha, JobSuperseded)
+		if err != nil {
+			LogError.Errorf("Supersede jobs of %s error: %v", message.PullKey(), err)
+			// PASS
+		}
+	}
+	if message.DeliveryID != "" {
+		err = store.UpdateDeliveryJob(message.DeliveryID, message.ID)
+		if err != nil {
+			LogError.Errorf("Update job of delivery %s error: %v", message.DeliveryID, err)
+			// PASS
+		}
+	}
+	return nil
+}
+
+// pushHeadMessage pushes the message of pull request if its commit is the
+// current head of pull request, so that the rerequested, replayed or
+// out-of-order messages of older commits do not supersede the head in queue,
+// ErrNotPullHead is returned otherwise
+func pushHeadMessage(message *mq.Message, head string) error {
+	if message.Sha != head {
+		return ErrNotPullHead
+	}
+	return pushMessage(message)
+}
+
+// skipNotPullHead responds to the webhook whose commit is not the head of
+// pull request, the delivery is accepted without queueing
+func skipNotPullHead(c *gin.Context, message *mq.Message) {
+	LogAccess.Info("Skip message of outdated commit: " + message.String())
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"info": "skip the commit which is not the head of pull request",
+	})
+}
+
+// dropJobs records the jobs of messages removed from queue are completed with
+// conclusion, the running ones are left to their workers
+func dropJobs(conclusion string, messages ...*mq.Message) {
+	for _, message := range messages {
+		if message.ID == "" {
+			continue
+		}
+		job, err := store.LoadJob(message.ID)
+		if err == nil && job != nil && job.Status != store.JobRunning && job.Status != store.JobCompleted {
+			err = job.Finish(conclusion)
+		}
+		if err != nil {
+			LogError.Errorf("Drop job %s error: %v", message.ID, err)
+			// PASS
+		}
+	}
+}
+
+// startJob records message is started by this worker, the returned job
+// collects the results of message and is never nil
+func startJob(message *mq.Message) *store.Job {
+	job := newJob(message)
+	if message.ID == "" {
+		// legacy message is not recorded
+		return job
+	}
+	saved, err := store.LoadJob(message.ID)
+	if err == nil {
+		if saved != nil {
+			job = saved
+		} else {
+			// pushed before jobs are recorded
+			err = job.Save()
+		}
+	}
+	if err == nil {
+		err = job.Start(WorkerID)
+	}
+	if err != nil {
+		LogError.Errorf("Start job %s error: %v", message.ID, err)
+		// PASS
+	}
+	reportJob(job)
+	return job
+}
+
+// finishJob records the job is completed, or failed if err is not nil
+func finishJob(job *store.Job, err error) {
+	if job.ID == "" {
+		return
+	}
+	if err != nil {
+		err = job.Fail(err.Error())
+	} else {
+		conclusion := job.Conclusion
+		if conclusion == "" {
+			conclusion = JobSkipped
+		}
+		err = job.Finish(conclusion)
+	}
+	if err != nil {
+		LogError.Errorf("Finish job %s error: %v", job.ID, err)
+		// PASS
+	}
+	reportJob(job)
+}
+
+// reportJob reports the state of job to the server if this process is a
+// worker, whose local store is not served by jobs API
+func reportJob(job *store.Job) {
+	if !WorkerOnly || job.ID == "" {
+		return
+	}
+	state, err := json.Marshal(job)
+	if err == nil {
+		err = MQ.ReportJob(state)
+	}
+	if err != nil {
+		LogError.Errorf("Report job %s error: %v", job.ID, err)
+		// PASS
+	}
+}
+
+// SyncJobReports records the states of jobs reported by workers
+func SyncJobReports(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			LogAccess.Warn("SyncJobReports canceled.")
+			return
+		case <-time.After(syncJobsInterval):
+		}
+		syncJobReports()
+	}
+}
+
+// syncJobReports records the reported states of jobs until none is left
+func syncJobReports() {
+	for {
+		reports, err := MQ.PopJobReports(syncJobsBatch)
+		if err != nil {
+			LogError.Error("mq pop job reports error: " + err.Error())
+			return
+		}
+		for _, state := range reports {
+			var job store.Job
+			err = json.Unmarshal(state, &job)
+			if err == nil {
+				err = job.Sync()
+			}
+			if err != nil {
+				LogError.Errorf("Sync job report %s error: %v", state, err)
+				// PASS
+			}
+		}
+		if len(reports) < syncJobsBatch {
+			return
+		}
+	}
+}
+
+func jobsHandler(c *gin.Context) {
+	filter := store.JobFilter{
+		Forge:  c.Query("forge"),
+		Owner:  c.Query("owner"),
+		Repo:   c.Query("repo"),
+		Status: c.Query("status"),
+	}
+	var err error
+	if pr := c.Query("pr"); pr != "" {
+		filter.PRNum, err = strconv.Atoi(pr)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, "invalid pr: "+pr)
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, "invalid limit: "+limit)
+			return
+		}
+	}
+	jobs, err := store.ListJobs(filter)
+	if err != nil {
+		LogError.Errorf("ListJobs error: %v", err)
+		abortWithError(c, http.StatusInternalServerError, "list jobs error")
+		return
+	}
+	if jobs == nil {
+		jobs = []store.Job{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"info": jobs,
+	})
+}
@@ -0,0 +1,160 @@
+package checker
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tengattack/unified-ci/forge"
+	"github.com/tengattack/unified-ci/mq"
+	"github.com/tengattack/unified-ci/mq/sqlite"
+	"github.com/tengattack/unified-ci/store"
+)
+
+func TestJobs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fileDB := "jobs test.db"
+	q := sqlite.New(sqlite.Config{File: fileDB})
+	require.NoError(q.Init())
+	defer os.Remove(fileDB)
+	defer q.Deinit()
+	MQ = q
+	defer func() { MQ = nil }()
+	defer useTestStore(t, "jobs store test.db")()
+
+	m1 := mq.NewPullMessage("owner", "repo", 1, "sha1")
+	m2 := mq.NewPullMessage("owner", "repo", 2, "sha2")
+	require.NoError(pushMessage(m1))
+	require.NoError(pushMessage(m2))
+
+	job := startJob(m1)
+	assert.Equal(store.JobRunning, job.Status)
+	finishJob(job, errors.New("network error"))
+	job = startJob(m1)
+	job.LintProblems = 1
+	job.Conclusion = "failure"
+	finishJob(job, nil)
+
+	_, r := gin.CreateTestContext(httptest.NewRecorder())
+	r.GET("/api/jobs", jobsHandler)
+
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/jobs?owner=owner&repo=repo&pr=1", nil)
+	r.ServeHTTP(resp, req)
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), `"conclusion":"failure"`)
+	assert.Contains(resp.Body.String(), `"lint_problems":1`)
+	assert.NotContains(resp.Body.String(), m2.ID)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/jobs?status=queued", nil)
+	r.ServeHTTP(resp, req)
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), m2.ID)
+	assert.NotContains(resp.Body.String(), m1.ID)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/jobs?pr=x", nil)
+	r.ServeHTTP(resp, req)
+	assert.Equal(http.StatusBadRequest, resp.Code)
+
+	// the queued job of the older commit is superseded
+	m3 := mq.NewPullMessage("owner", "repo", 2, "sha3")
+	require.NoError(pushMessage(m3))
+	job, err := store.LoadJob(m2.ID)
+	require.NoError(err)
+	require.NotNil(job)
+	assert.Equal(store.JobCompleted, job.Status)
+	assert.Equal(JobSuperseded, job.Conclusion)
+
+	// the merge request of another forge with the same number is apart
+	m4 := mq.NewPullMessage("owner", "repo", 2, "sha4")
+	m4.Forge = forge.GitLab
+	require.NoError(pushMessage(m4))
+	job, err = store.LoadJob(m3.ID)
+	require.NoError(err)
+	require.NotNil(job)
+	assert.Equal(store.JobQueued, job.Status)
+	assert.Equal(forge.GitHub, job.Forge)
+
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/jobs?forge=gitlab", nil)
+	r.ServeHTTP(resp, req)
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.Contains(resp.Body.String(), m4.ID)
+	assert.NotContains(resp.Body.String(), m3.ID)
+
+	messages, err := MQ.Purge(mq.ChannelQueue)
+	require.NoError(err)
+	require.Len(messages, 3)
+	dropJobs(JobDropped, messages...)
+	job, err = store.LoadJob(m3.ID)
+	require.NoError(err)
+	require.NotNil(job)
+	assert.Equal(JobDropped, job.Conclusion)
+	// the finished job is kept
+	job, err = store.LoadJob(m1.ID)
+	require.NoError(err)
+	require.NotNil(job)
+	assert.Equal("failure", job.Conclusion)
+
+	// the jobs are not public
+	resp = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/jobs", nil)
+	routerEngine().ServeHTTP(resp, req)
+	assert.Equal(http.StatusForbidden, resp.Code)
+}
+
+func TestWorkerJobs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fileDB := "worker jobs test.db"
+	q := sqlite.New(sqlite.Config{File: fileDB})
+	require.NoError(q.Init())
+	defer os.Remove(fileDB)
+	defer q.Deinit()
+	MQ = q
+	defer func() { MQ = nil }()
+
+	// queued by the server
+	m := mq.NewPullMessage("owner", "repo", 1, "sha1")
+	defer useTestStore(t, "server jobs test.db")()
+	require.NoError(pushMessage(m))
+
+	// processed by a worker with its own store
+	resetWorkerStore := useTestStore(t, "worker store test.db")
+	WorkerOnly = true
+	job := startJob(m)
+	job.LintProblems = 1
+	job.Conclusion = "failure"
+	finishJob(job, nil)
+	WorkerOnly = false
+	resetWorkerStore()
+
+	store.Deinit()
+	require.NoError(store.Init("server jobs test.db"))
+	job, err := store.LoadJob(m.ID)
+	require.NoError(err)
+	require.NotNil(job)
+	assert.Equal(store.JobQueued, job.Status)
+
+	syncJobReports()
+	job, err = store.LoadJob(m.ID)
+	require.NoError(err)
+	require.NotNil(job)
+	assert.Equal(store.JobCompleted, job.Status)
+	assert.Equal("failure", job.Conclusion)
+	assert.Equal(1, job.LintProblems)
+	assert.Equal(WorkerID, job.WorkerID)
+	reports, err := MQ.PopJobReports(syncJobsBatch)
+	assert.NoError(err)
+	assert.Empty(reports)
+}
@@ -19,10 +19,10 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/go-github/github"
 	"github.com/martinlindhe/go-difflib/difflib"
 	"github.com/sourcegraph/go-diff/diff"
 	"github.com/sqs/goreturns/returns"
+	"github.com/tengattack/unified-ci/forge"
 	"github.com/tengattack/unified-ci/util"
 	"golang.org/x/lint"
 	"golang.org/x/tools/imports"
@@ -31,6 +31,9 @@ import (
 // A value in (0,1] estimating the confidence of correctness in golint reports
 // This value is used internally by golint. Its default value is 0.8
 const golintMinConfidenceDefault = 0.8
+
+// Severity levels of lint messages, they are reported as notice, warning and
+// failure annotations respectively
 const (
 	severityLevelOff = iota
 	severityLevelWarning
@@ -43,22 +46,6 @@ const (
 	ruleClangLint         = "clanglint"
 )
 
-// LintEnabled list enabled linter
-type LintEnabled struct {
-	CPP        bool
-	OC         bool
-	ClangLint  bool
-	Go         bool
-	PHP        bool
-	TypeScript bool
-	SCSS       bool
-	JS         string
-	ES         string
-	MD         bool
-	APIDoc     bool
-	Android    bool
-}
-
 // LintMessage is a single lint message for PHPLint
 type LintMessage struct {
 	RuleID     string `json:"ruleId"`
@@ -67,6 +54,11 @@ type LintMessage struct {
 	Column     int    `json:"column"`
 	Message    string `json:"message"`
 	SourceCode string `json:"sourceCode,omitempty"`
+	// FilePath is set by the linters of whole repository
+	FilePath string `json:"-"`
+	// Formatted marks the suggestion of formatter, the lines from Line to
+	// Line+Column-1 are replaced by the diff in Message
+	Formatted bool `json:"-"`
 }
 
 // LintResult is a single lint result for PHPLint
@@ -110,7 +102,71 @@ func init() {
 		"off":     severityLevelOff,
 		"warning": severityLevelWarning,
 		"error":   severityLevelError,
+		// Android lint, checkstyle and SARIF
+		"fatal":       severityLevelError,
+		"information": severityLevelOff,
+		"info":        severityLevelOff,
+		"ignore":      severityLevelOff,
+		"note":        severityLevelOff,
+		"none":        severityLevelOff,
+		// code climate
+		"minor":    severityLevelWarning,
+		"major":    severityLevelError,
+		"critical": severityLevelError,
+		"blocker":  severityLevelError,
+	}
+}
+
+// lintSeverity returns the severity level of name, unknown ones are warnings
+func lintSeverity(name string) int {
+	level, ok := LintSeverity[strings.ToLower(name)]
+	if !ok {
+		return severityLevelWarning
+	}
+	return level
+}
+
+// codeClimateSeverity returns the severity level of code climate issue, the
+// issues without severity (e.g. from golangci-lint) are errors
+func codeClimateSeverity(severity string) int {
+	if severity == "" {
+		return severityLevelError
 	}
+	return lintSeverity(severity)
+}
+
+// annotationLevel returns the annotation level of severity
+func annotationLevel(severity int) string {
+	switch {
+	case severity >= severityLevelError:
+		return forge.LevelFailure
+	case severity == severityLevelWarning:
+		return forge.LevelWarning
+	}
+	return forge.LevelNotice
+}
+
+// annotationLevelRanks are the ranks of annotation levels, the higher ones
+// are more severe
+var annotationLevelRanks = map[string]int{
+	forge.LevelNotice:  0,
+	forge.LevelWarning: 1,
+	forge.LevelFailure: 2,
+}
+
+// countFailures counts the annotations at or above failLevel, which is
+// failure if empty
+func countFailures(annotations []*forge.Annotation, failLevel string) int {
+	if failLevel == "" {
+		failLevel = forge.LevelFailure
+	}
+	failures := 0
+	for _, a := range annotations {
+		if annotationLevelRanks[a.Level] >= annotationLevelRanks[failLevel] {
+			failures++
+		}
+	}
+	return failures
 }
 
 func isCPP(fileName string) bool {
@@ -137,65 +193,6 @@ func isOC(fileName string) bool {
 	}
 }
 
-// Init default LintEnabled struct
-func (lintEnabled *LintEnabled) Init(cwd string) {
-
-	// reset to defaults
-	lintEnabled.CPP = false
-	lintEnabled.OC = false
-	lintEnabled.ClangLint = false
-	lintEnabled.Go = false
-	lintEnabled.PHP = true
-	lintEnabled.TypeScript = false
-	lintEnabled.SCSS = false
-	lintEnabled.JS = ""
-	lintEnabled.ES = ""
-	lintEnabled.MD = false
-	lintEnabled.APIDoc = false
-	lintEnabled.Android = false
-
-	if _, err := os.Stat(filepath.Join(cwd, ".golangci.yml")); err == nil {
-		lintEnabled.Go = true
-	}
-	if _, err := os.Stat(filepath.Join(cwd, "CPPLINT.cfg")); err == nil {
-		lintEnabled.CPP = true
-	}
-	if _, err := os.Stat(filepath.Join(cwd, ".oclint")); err == nil {
-		lintEnabled.OC = true
-	}
-	if _, err := os.Stat(filepath.Join(cwd, ".clang-format")); err == nil {
-		lintEnabled.ClangLint = true
-	}
-	if _, err := os.Stat(filepath.Join(cwd, ".remarkrc")); err == nil {
-		lintEnabled.MD = true
-	} else if _, err := os.Stat(filepath.Join(cwd, ".remarkrc.js")); err == nil {
-		lintEnabled.MD = true
-	}
-	if _, err := os.Stat(filepath.Join(cwd, "tslint.json")); err == nil {
-		lintEnabled.TypeScript = true
-	}
-	if _, err := os.Stat(filepath.Join(cwd, ".scss-lint.yml")); err == nil {
-		lintEnabled.SCSS = true
-	}
-	if _, err := os.Stat(filepath.Join(cwd, ".eslintrc")); err == nil {
-		lintEnabled.ES = filepath.Join(cwd, ".eslintrc")
-	}
-	if _, err := os.Stat(filepath.Join(cwd, ".eslintrc.js")); err == nil {
-		lintEnabled.JS = filepath.Join(cwd, ".eslintrc.js")
-		if lintEnabled.ES == "" {
-			lintEnabled.ES = lintEnabled.JS
-		}
-	} else {
-		lintEnabled.JS = lintEnabled.ES
-	}
-	if _, err := os.Stat(filepath.Join(cwd, "apidoc.json")); err == nil {
-		lintEnabled.APIDoc = true
-	}
-	if _, err := os.Stat(filepath.Join(cwd, "build.gradle")); err == nil {
-		lintEnabled.Android = true
-	}
-}
-
 // CPPLint lints the cpp language files using github.com/cpplint/cpplint
 func CPPLint(ref GithubRef, filePath string, cwd string) (lints []LintMessage, err error) {
 	parser := NewShellParser(cwd, ref)
@@ -274,6 +271,7 @@ type oclintViolation struct {
 
 	Message   string `xml:"message,attr"`
 	Rule      string `xml:"rule,attr"`
+	Priority  int    `xml:"priority,attr"`
 	StartLine int    `xml:"startline,attr"`
 	EndLine   int    `xml:"endline,attr"`
 	Path      string `xml:"path,attr"`
@@ -317,15 +315,28 @@ func OCLint(ctx context.Context, ref GithubRef, filePath string, cwd string) (li
 
 	for _, v := range violations.Violations.Violations {
 		lints = append(lints, LintMessage{
-			RuleID:  v.Rule,
-			Line:    v.StartLine,
-			Column:  v.EndLine, // %d:%d, using the second number as the endline number in oclint
-			Message: v.Message,
+			RuleID:   v.Rule,
+			Severity: oclintSeverity(v.Priority),
+			Line:     v.StartLine,
+			Column:   v.EndLine, // %d:%d, using the second number as the endline number in oclint
+			Message:  v.Message,
 		})
 	}
 	return lints, nil
 }
 
+// oclintSeverity returns the severity level of OCLint priority, priority 1 is
+// the most severe
+func oclintSeverity(priority int) int {
+	switch priority {
+	case 1:
+		return severityLevelError
+	case 2:
+		return severityLevelWarning
+	}
+	return severityLevelOff
+}
+
 // PHPLint lints the php files
 func PHPLint(ref GithubRef, fileName, cwd string) ([]LintMessage, string, error) {
 	var stderr bytes.Buffer
@@ -508,6 +519,8 @@ func SCSSLint(ref GithubRef, fileName, cwd string) ([]LintMessage, string, error
 // CodeClimate --out-format code-climate
 type CodeClimate struct {
 	Description string `json:"description"`
+	CheckName   string `json:"check_name"`
+	Severity    string `json:"severity,omitempty"`
 	Location    struct {
 		Path  string `json:"path"`
 		Lines struct {
@@ -665,9 +678,10 @@ func MDLint(rps []remarkReport) (lints []LintMessage, err error) {
 		if i == 0 {
 			for _, m := range r.Messages {
 				lints = append(lints, LintMessage{
-					RuleID:  m.RuleID,
-					Line:    m.Line,
-					Message: m.Reason,
+					RuleID:   m.RuleID,
+					Severity: m.severity(),
+					Line:     m.Line,
+					Message:  m.Reason,
 				})
 			}
 		}
@@ -683,6 +697,18 @@ type remarkMessage struct {
 	Line   int
 	Reason string
 	RuleID string
+	// Fatal is true for errors, false for warnings and null for infos
+	Fatal *bool
+}
+
+func (m remarkMessage) severity() int {
+	if m.Fatal == nil {
+		return severityLevelOff
+	}
+	if *m.Fatal {
+		return severityLevelError
+	}
+	return severityLevelWarning
 }
 
 func remark(ref GithubRef, fileName string, cwd string) (reports []remarkReport, out []byte, err error) {
@@ -833,13 +859,13 @@ const (
 )
 
 // CheckFileMode checks repo's files' mode
-func CheckFileMode(diffs []*diff.FileDiff, repoPath string, log io.StringWriter) ([]*github.CheckRunAnnotation, int, error) {
+func CheckFileMode(diffs []*diff.FileDiff, repoPath string, log io.StringWriter) ([]*forge.Annotation, int, error) {
 	startLine := 1
 	endLine := 1
-	annotationLevel := "warning"
+	level := forge.LevelWarning
 
 	problem := 0
-	annotations := make([]*github.CheckRunAnnotation, 0, len(diffs))
+	annotations := make([]*forge.Annotation, 0, len(diffs))
 	for _, d := range diffs {
 		fileName, _ := getTrimmedNewName(d)
 		filePath := filepath.Join(repoPath, fileName)
@@ -891,12 +917,12 @@ func CheckFileMode(diffs []*diff.FileDiff, repoPath string, log io.StringWriter)
 			}
 		}
 		if comment != "" {
-			annotations = append(annotations, &github.CheckRunAnnotation{
-				Path:            &fileName,
-				StartLine:       &startLine,
-				EndLine:         &endLine,
-				AnnotationLevel: &annotationLevel,
-				Message:         &comment,
+			annotations = append(annotations, &forge.Annotation{
+				Path:      fileName,
+				StartLine: startLine,
+				EndLine:   endLine,
+				Level:     level,
+				Message:   comment,
 			})
 		}
 	}
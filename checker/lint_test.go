@@ -10,6 +10,7 @@ import (
 	"github.com/sourcegraph/go-diff/diff"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tengattack/unified-ci/forge"
 )
 
 func TestParseAPIDocCommands(t *testing.T) {
@@ -38,6 +39,27 @@ func TestOCLintResultXML(t *testing.T) {
 	assert.NotEmpty(violations)
 }
 
+func TestAnnotationLevel(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(forge.LevelFailure, annotationLevel(lintSeverity("Fatal")))
+	assert.Equal(forge.LevelFailure, annotationLevel(codeClimateSeverity("")))
+	assert.Equal(forge.LevelWarning, annotationLevel(lintSeverity("minor")))
+	assert.Equal(forge.LevelWarning, annotationLevel(lintSeverity("unknown")))
+	assert.Equal(forge.LevelNotice, annotationLevel(lintSeverity("Information")))
+	assert.Equal(forge.LevelNotice, annotationLevel(oclintSeverity(3)))
+
+	annotations := []*forge.Annotation{
+		{Level: forge.LevelNotice},
+		{Level: forge.LevelWarning},
+		{Level: forge.LevelFailure},
+		{Level: forge.LevelFailure},
+	}
+	assert.Equal(2, countFailures(annotations, ""))
+	assert.Equal(3, countFailures(annotations, forge.LevelWarning))
+	assert.Equal(4, countFailures(annotations, forge.LevelNotice))
+}
+
 func TestCheckFileMode(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -55,17 +77,17 @@ func TestCheckFileMode(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal(4, problems)
 	for _, v := range lints {
-		switch v.GetPath() {
+		switch v.Path {
 		case "c.sh":
-			assert.Equal(fileModeCheckShellScript, v.GetMessage())
+			assert.Equal(fileModeCheckShellScript, v.Message)
 		case "d.sh":
-			assert.Equal(shebangCheckShellScript, v.GetMessage())
+			assert.Equal(shebangCheckShellScript, v.Message)
 		case "h.py":
-			assert.Equal(fileModeCheckExecutable, v.GetMessage())
+			assert.Equal(fileModeCheckExecutable, v.Message)
 		case "b.py":
-			assert.Equal(fileModeCheckNormal, v.GetMessage())
+			assert.Equal(fileModeCheckNormal, v.Message)
 		default:
-			assert.Fail(v.GetPath() + " should not be ok")
+			assert.Fail(v.Path + " should not be ok")
 		}
 	}
 }
@@ -0,0 +1,298 @@
+package checker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// Linter is a lint tool checking the files of repository, it is either a
+// FileLinter or a RepoLinter
+type Linter interface {
+	// Name returns the name of linter, e.g. eslint
+	Name() string
+	// Match checks if the file is checked by the linter
+	Match(fileName string) bool
+	// Enabled detects if the linter is enabled in the repository, usually by
+	// its configuration file
+	Enabled(repoPath string) bool
+}
+
+// FileLinter lints the changed files one by one
+type FileLinter interface {
+	Linter
+	// LintFile lints the file relative to repoPath, output is written to the
+	// log of check
+	LintFile(ctx context.Context, ref GithubRef, repoPath, fileName string) (lints []LintMessage, output string, err error)
+}
+
+// RepoLinter lints the whole repository at once, it runs only if any of the
+// changed files matches
+type RepoLinter interface {
+	Linter
+	// LintRepo lints the repository, FilePath of the lint messages is set to
+	// the path relative to repoPath
+	LintRepo(ctx context.Context, ref GithubRef, repoPath string) (lints []LintMessage, output string, err error)
+}
+
+var linters []Linter
+
+// RegisterLinter adds the linter to registry, the linters run in the order
+// they are registered
+func RegisterLinter(l Linter) {
+	linters = append(linters, l)
+}
+
+// EnabledLinters returns the registered linters enabled in the repository
+func EnabledLinters(repoPath string) []Linter {
+	var enabled []Linter
+	for _, l := range linters {
+		if l.Enabled(repoPath) {
+			enabled = append(enabled, l)
+		}
+	}
+	return enabled
+}
+
+// baseLinter implements the name, matcher and enablement of linter
+type baseLinter struct {
+	name  string
+	match func(fileName string) bool
+	// configs are the configuration files enabling the linter, it is always
+	// enabled if there are none
+	configs []string
+	// yields are the names of linters taking precedence over the linter, the
+	// files matched by any of them enabled are not linted by the linter
+	yields []string
+}
+
+func (l *baseLinter) Name() string {
+	return l.name
+}
+
+func (l *baseLinter) Match(fileName string) bool {
+	return l.match(fileName)
+}
+
+func (l *baseLinter) Enabled(repoPath string) bool {
+	if len(l.configs) == 0 {
+		return true
+	}
+	return findConfig(repoPath, l.configs...) != ""
+}
+
+func (l *baseLinter) Yields() []string {
+	return l.yields
+}
+
+// yieldingLinter is the linter leaving some files to other linters
+type yieldingLinter interface {
+	Yields() []string
+}
+
+// yielded checks if the file is left to one of the enabled linters taking
+// precedence over l
+func yielded(l Linter, fileName string, enabled []Linter) bool {
+	yl, ok := l.(yieldingLinter)
+	if !ok {
+		return false
+	}
+	for _, name := range yl.Yields() {
+		for _, e := range enabled {
+			if e.Name() == name && e.Match(fileName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findConfig returns the path of the first configuration file existing in
+// the repository
+func findConfig(repoPath string, configs ...string) string {
+	for _, c := range configs {
+		p := filepath.Join(repoPath, c)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// hasExt returns the matcher of file extensions
+func hasExt(exts ...string) func(fileName string) bool {
+	return func(fileName string) bool {
+		ext := filepath.Ext(fileName)
+		for _, e := range exts {
+			if ext == e {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+type fileLinter struct {
+	baseLinter
+	lint func(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error)
+}
+
+func (l *fileLinter) LintFile(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error) {
+	return l.lint(ctx, ref, repoPath, fileName)
+}
+
+type repoLinter struct {
+	baseLinter
+	lint func(ctx context.Context, ref GithubRef, repoPath string) ([]LintMessage, string, error)
+}
+
+func (l *repoLinter) LintRepo(ctx context.Context, ref GithubRef, repoPath string) ([]LintMessage, string, error) {
+	return l.lint(ctx, ref, repoPath)
+}
+
+func init() {
+	RegisterLinter(&fileLinter{
+		baseLinter: baseLinter{name: ruleMarkdownFormatted, match: hasExt(".md"), configs: []string{".remarkrc", ".remarkrc.js"}},
+		lint:       remarkLint,
+	})
+	RegisterLinter(&fileLinter{
+		baseLinter: baseLinter{name: "cpplint", match: isCPP, configs: []string{"CPPLINT.cfg"}},
+		lint: func(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error) {
+			lints, err := CPPLint(ref, fileName, repoPath)
+			return lints, "", err
+		},
+	})
+	RegisterLinter(&fileLinter{
+		// the C/C++ files are linted by cpplint if it is enabled
+		baseLinter: baseLinter{name: "oclint", match: isOC, configs: []string{".oclint"}, yields: []string{"cpplint"}},
+		lint: func(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error) {
+			lints, err := OCLint(ctx, ref, fileName, repoPath)
+			return lints, "", err
+		},
+	})
+	RegisterLinter(&fileLinter{
+		baseLinter: baseLinter{name: ruleClangLint, match: isOC, configs: []string{".clang-format"}, yields: []string{"cpplint"}},
+		lint: func(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error) {
+			lints, err := ClangLint(ctx, ref, repoPath, filepath.Join(repoPath, fileName))
+			return lints, "", err
+		},
+	})
+	RegisterLinter(&fileLinter{
+		baseLinter: baseLinter{name: ruleGoreturns, match: hasExt(".go"), configs: []string{".golangci.yml"}},
+		lint: func(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error) {
+			lints, err := Goreturns(filepath.Join(repoPath, fileName), repoPath)
+			return lints, "", err
+		},
+	})
+	RegisterLinter(&fileLinter{
+		baseLinter: baseLinter{name: ruleGolint, match: hasExt(".go"), configs: []string{".golangci.yml"}},
+		lint: func(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error) {
+			lints, err := Golint(filepath.Join(repoPath, fileName), repoPath)
+			return lints, "", err
+		},
+	})
+	RegisterLinter(&fileLinter{
+		baseLinter: baseLinter{name: "phplint", match: hasExt(".php")},
+		lint: func(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error) {
+			return PHPLint(ref, filepath.Join(repoPath, fileName), repoPath)
+		},
+	})
+	RegisterLinter(&fileLinter{
+		baseLinter: baseLinter{name: "tslint", match: hasExt(".ts", ".tsx"), configs: []string{"tslint.json"}},
+		lint: func(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error) {
+			return TSLint(ref, filepath.Join(repoPath, fileName), repoPath)
+		},
+	})
+	RegisterLinter(&fileLinter{
+		baseLinter: baseLinter{name: "scsslint", match: hasExt(".scss", ".css"), configs: []string{".scss-lint.yml"}},
+		lint: func(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error) {
+			return SCSSLint(ref, filepath.Join(repoPath, fileName), repoPath)
+		},
+	})
+	RegisterLinter(&fileLinter{
+		baseLinter: baseLinter{
+			name:    "eslint",
+			match:   hasExt(".js", ".es", ".esx", ".jsx", ".html", ".php"),
+			configs: []string{".eslintrc", ".eslintrc.js"},
+		},
+		lint: func(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error) {
+			return ESLint(ref, filepath.Join(repoPath, fileName), repoPath, eslintConfig(repoPath, fileName))
+		},
+	})
+
+	RegisterLinter(&repoLinter{
+		// issues may be reported on any file of the project
+		baseLinter: baseLinter{name: "androidlint", match: func(string) bool { return true }, configs: []string{"build.gradle"}},
+		lint:       androidLint,
+	})
+	RegisterLinter(&repoLinter{
+		baseLinter: baseLinter{name: "golangci", match: hasExt(".go"), configs: []string{".golangci.yml"}},
+		lint:       golangCILint,
+	})
+}
+
+// eslintConfig returns the configuration of ESLint for the file, the .js,
+// .html and .php files prefer .eslintrc.js to .eslintrc (ES5), and the others
+// prefer .eslintrc
+func eslintConfig(repoPath, fileName string) string {
+	switch filepath.Ext(fileName) {
+	case ".es", ".esx", ".jsx":
+		return findConfig(repoPath, ".eslintrc", ".eslintrc.js")
+	}
+	return findConfig(repoPath, ".eslintrc.js", ".eslintrc")
+}
+
+// remarkLint reports the problems and the formatting of markdown file
+func remarkLint(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error) {
+	rps, out, err := remark(ref, fileName, repoPath)
+	if err != nil {
+		return nil, "", err
+	}
+	lints, err := MDFormattedLint(filepath.Join(repoPath, fileName), out)
+	if err != nil {
+		return nil, "", err
+	}
+	lintsMD, err := MDLint(rps)
+	return append(lints, lintsMD...), "", err
+}
+
+func androidLint(ctx context.Context, ref GithubRef, repoPath string) ([]LintMessage, string, error) {
+	issues, output, err := AndroidLint(ctx, ref, repoPath)
+	if err != nil {
+		return nil, output, err
+	}
+	lints := make([]LintMessage, len(issues.Issues))
+	for i, v := range issues.Issues {
+		ruleID := v.ID
+		if v.Category != "" {
+			ruleID = v.Category + "." + v.ID
+		}
+		lints[i] = LintMessage{
+			FilePath: v.Location.File,
+			RuleID:   ruleID,
+			Severity: lintSeverity(v.Severity),
+			Line:     v.Location.Line,
+			Column:   v.Location.Column,
+			Message:  v.Message,
+		}
+	}
+	return lints, output, nil
+}
+
+func golangCILint(ctx context.Context, ref GithubRef, repoPath string) ([]LintMessage, string, error) {
+	suggestions, output, err := GolangCILint(ctx, ref, repoPath)
+	if err != nil {
+		return nil, output, err
+	}
+	lints := make([]LintMessage, len(suggestions))
+	for i, v := range suggestions {
+		lints[i] = LintMessage{
+			FilePath: v.Location.Path,
+			RuleID:   v.CheckName,
+			Severity: codeClimateSeverity(v.Severity),
+			Line:     v.Location.Lines.Begin,
+			Message:  v.Description,
+		}
+	}
+	return lints, output, nil
+}
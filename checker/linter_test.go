@@ -0,0 +1,118 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sourcegraph/go-diff/diff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tengattack/unified-ci/forge"
+)
+
+func linterNames(linters []Linter) []string {
+	names := make([]string, len(linters))
+	for i, l := range linters {
+		names[i] = l.Name()
+	}
+	return names
+}
+
+func TestEnabledLinters(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"goreturns", "golint", "phplint", "golangci"}, linterNames(EnabledLinters("../testdata/go")))
+	assert.Equal([]string{"remark", "phplint"}, linterNames(EnabledLinters("../testdata/markdown")))
+	assert.Equal([]string{"clanglint", "phplint"}, linterNames(EnabledLinters("../testdata/Objective-C")))
+	assert.Equal([]string{"phplint", "androidlint"}, linterNames(EnabledLinters("../testdata/Android")))
+}
+
+func TestLinterYields(t *testing.T) {
+	assert := assert.New(t)
+
+	var cpplint, oclint Linter
+	for _, l := range linters {
+		switch l.Name() {
+		case "cpplint":
+			cpplint = l
+		case "oclint":
+			oclint = l
+		}
+	}
+	// the C/C++ files are left to cpplint if it is enabled
+	assert.True(yielded(oclint, "a.h", []Linter{cpplint, oclint}))
+	assert.False(yielded(oclint, "a.m", []Linter{cpplint, oclint}))
+	assert.False(yielded(oclint, "a.h", []Linter{oclint}))
+	assert.False(yielded(cpplint, "a.h", []Linter{cpplint, oclint}))
+}
+
+func TestESLintConfig(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "eslint")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	assert.Empty(eslintConfig(dir, "a.js"))
+	require.NoError(ioutil.WriteFile(filepath.Join(dir, ".eslintrc"), []byte("{}"), 0644))
+	assert.Equal(filepath.Join(dir, ".eslintrc"), eslintConfig(dir, "a.js"))
+	require.NoError(ioutil.WriteFile(filepath.Join(dir, ".eslintrc.js"), []byte(""), 0644))
+	assert.Equal(filepath.Join(dir, ".eslintrc.js"), eslintConfig(dir, "a.php"))
+	assert.Equal(filepath.Join(dir, ".eslintrc"), eslintConfig(dir, "a.jsx"))
+}
+
+type fakeLinter struct {
+	baseLinter
+	lints []LintMessage
+}
+
+func (l *fakeLinter) LintFile(ctx context.Context, ref GithubRef, repoPath, fileName string) ([]LintMessage, string, error) {
+	return l.lints, "fake output", nil
+}
+
+func TestRegisterLinter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	registered := linters
+	defer func() { linters = registered }()
+	linters = nil
+	RegisterLinter(&fakeLinter{
+		baseLinter: baseLinter{name: "fake", match: hasExt(".txt")},
+		lints: []LintMessage{
+			{RuleID: "new", Line: 2, Message: "on the new line"},
+			{RuleID: "old", Line: 1, Message: "on the context line"},
+		},
+	})
+	enabled := EnabledLinters("")
+	require.Len(enabled, 1)
+
+	d, err := diff.ParseFileDiff([]byte("--- a/a.txt\n+++ b/a.txt\n@@ -1 +1,2 @@\n a\n+b\n"))
+	require.NoError(err)
+	var (
+		buf         bytes.Buffer
+		annotations []*forge.Annotation
+		problems    int
+	)
+	report := newSARIFReport()
+	require.NoError(handleSingleFile(context.TODO(), GithubRef{}, "", d, enabled, report, &buf, &annotations, &problems))
+	assert.Equal(1, problems)
+	require.Len(annotations, 1)
+	assert.Equal("a.txt", annotations[0].Path)
+	assert.Equal(2, annotations[0].StartLine)
+	assert.Equal("`new` 2:0 on the new line", annotations[0].Message)
+	assert.Contains(buf.String(), "fake 'a.txt'\nfake output\n")
+
+	// all the lint messages are reported
+	runs := report.SARIF().Runs
+	require.Len(runs, 1)
+	assert.Equal("fake", runs[0].Tool.Driver.Name)
+	require.Len(runs[0].Results, 2)
+	assert.Equal("new", runs[0].Results[0].RuleID)
+	assert.Equal("a.txt", runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+}
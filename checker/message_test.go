@@ -11,11 +11,12 @@ import (
 	"sync"
 	"testing"
 
-	"github.com/google/go-github/github"
 	"github.com/sourcegraph/go-diff/diff"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/tengattack/unified-ci/config"
+	"github.com/tengattack/unified-ci/forge"
+	"github.com/tengattack/unified-ci/mq"
 	"github.com/tengattack/unified-ci/store"
 )
 
@@ -85,17 +86,16 @@ func TestGenerateComments(t *testing.T) {
 			diffs, err := diff.ParseMultiFileDiff(out)
 			require.NoError(err)
 
-			lintEnabled := LintEnabled{}
-			lintEnabled.Init(testRepoPath)
+			linters := EnabledLinters(testRepoPath)
 
-			annotations, problems, err := lintIndividually(GithubRef{}, testRepoPath, diffs, lintEnabled, nil, log)
+			annotations, problems, err := lintIndividually(context.TODO(), GithubRef{}, testRepoPath, diffs, linters, nil, nil, log)
 			require.NoError(err)
 			require.Equal(len(v.Annotations), problems)
 			for i, check := range v.Annotations {
-				assert.Equal(check.StartLine, *annotations[i].StartLine)
-				assert.Equal(check.Path, *annotations[i].Path)
+				assert.Equal(check.StartLine, annotations[i].StartLine)
+				assert.Equal(check.Path, annotations[i].Path)
 				for _, regexMessage := range check.Messages {
-					assert.Regexp(regexMessage, *annotations[i].Message)
+					assert.Regexp(regexMessage, annotations[i].Message)
 				}
 			}
 		})
@@ -156,14 +156,8 @@ func TestGetBaseCoverage(t *testing.T) {
 	assert.Empty(baseSavedRecords)
 	assert.Equal(len(tests), len(baseTestsNeedToRun))
 	var baseCoverage sync.Map
-	err = findBaseCoverage(baseSavedRecords, baseTestsNeedToRun, repoPath, baseSHA,
-		&github.PullRequest{
-			Head: &github.PullRequestBranch{
-				User: &github.User{
-					Login: &author,
-				},
-			},
-		}, ref, os.Stdout, &baseCoverage)
+	err = findBaseCoverage(context.Background(), baseSavedRecords, baseTestsNeedToRun, repoPath, baseSHA,
+		author, ref, os.Stdout, &baseCoverage)
 	require.NoError(err)
 
 	value, _ := baseCoverage.Load("go")
@@ -193,12 +187,11 @@ func TestLintRepo1(t *testing.T) {
 	diffs, err := diff.ParseMultiFileDiff(out)
 	require.NoError(err)
 
-	lintEnabled := LintEnabled{}
-	lintEnabled.Init(repoDir)
+	linters := EnabledLinters(repoDir)
 	Conf.Core.GolangCILint = "golangci-lint"
 
 	var buf strings.Builder
-	_, annotations, problems, err := lintRepo(context.TODO(), GithubRef{}, repoDir, diffs, lintEnabled, &buf)
+	_, annotations, problems, err := lintRepo(context.TODO(), GithubRef{}, repoDir, diffs, linters, nil, &buf)
 	require.NoError(err)
 	assert.NotEmpty(annotations)
 	assert.NotZero(problems)
@@ -221,8 +214,7 @@ func TestLintRepo2(t *testing.T) {
 	diffs, err := diff.ParseMultiFileDiff(out)
 	require.NoError(err)
 
-	lintEnabled := LintEnabled{}
-	lintEnabled.Init(repoDir)
+	linters := EnabledLinters(repoDir)
 	if runtime.GOOS == "windows" {
 		Conf.Core.AndroidLint = "gradlew.bat lint"
 	} else {
@@ -230,12 +222,89 @@ func TestLintRepo2(t *testing.T) {
 	}
 
 	var buf strings.Builder
-	_, annotations, problems, err := lintRepo(context.TODO(), GithubRef{}, repoDir, diffs, lintEnabled, &buf)
+	_, annotations, problems, err := lintRepo(context.TODO(), GithubRef{}, repoDir, diffs, linters, nil, &buf)
 	require.NoError(err)
 	assert.NotEmpty(annotations)
 	assert.NotZero(problems)
 }
 
+func TestLintRepoCustom(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	diffs, err := diff.ParseMultiFileDiff([]byte("diff --git a/src/a.py b/src/a.py\n" +
+		"--- a/src/a.py\n+++ b/src/a.py\n@@ -1,1 +1,1 @@\n-a = 1\n+a = 2\n" +
+		"diff --git a/b.sh b/b.sh\ndeleted file mode 100644\n" +
+		"--- a/b.sh\n+++ /dev/null\n@@ -1,1 +0,0 @@\n-echo b\n"))
+	require.NoError(err)
+
+	py, err := newCustomLinter("py", customLinterConfig{
+		Cmd:    `sh -c 'echo "src/a.py:1: bad"'`,
+		Format: formatRegexp,
+		Files:  []string{"src/*.py"},
+	})
+	require.NoError(err)
+	// the deleted files are not linted
+	sh, err := newCustomLinter("sh", customLinterConfig{Cmd: "sh -c 'exit 1'", Format: formatRegexp, Files: []string{"*.sh"}})
+	require.NoError(err)
+
+	var buf strings.Builder
+	_, annotations, problems, err := lintRepo(context.TODO(), GithubRef{}, "../testdata", diffs, []Linter{py, sh}, nil, &buf)
+	require.NoError(err)
+	require.Len(annotations, 1)
+	assert.Equal("src/a.py", annotations[0].Path)
+	assert.Equal(1, problems)
+}
+
+// summaryForge records the statuses and reviews created by the summary
+type summaryForge struct {
+	forge.Forge
+	states  []string
+	reviews []string
+}
+
+func (f *summaryForge) Name() string {
+	return "summary"
+}
+
+func (f *summaryForge) CreateStatus(ctx context.Context, owner, repo, sha string, status *forge.Status) error {
+	f.states = append(f.states, status.State)
+	return nil
+}
+
+func (f *summaryForge) CreateReview(ctx context.Context, owner, repo string, number int, sha, event, body string) error {
+	f.reviews = append(f.reviews, event)
+	return nil
+}
+
+func TestReportSummary(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ref := GithubRef{owner: "owner", repo: "repo", Sha: "sha"}
+	m := mq.NewPullMessage("owner", "repo", 1, "sha")
+	f := &summaryForge{}
+	var buf strings.Builder
+	require.NoError(reportSummary(f, ref, m, "", 0, 0, true, "", &buf))
+	assert.Equal([]string{forge.StateSuccess}, f.states)
+	assert.Equal([]string{forge.ReviewApprove}, f.reviews)
+
+	// the lint problems are unknown if only the tests run
+	m.Checks = []string{mq.CheckTest}
+	f = &summaryForge{}
+	buf.Reset()
+	require.NoError(reportSummary(f, ref, m, "", 0, 0, false, "", &buf))
+	assert.Empty(f.states)
+	assert.Empty(f.reviews)
+	assert.Contains(buf.String(), "restricted checks: test")
+
+	m = mq.NewTreeMessage("owner", "repo", "master", "sha")
+	f = &summaryForge{}
+	require.NoError(reportSummary(f, ref, m, "", 1, 0, true, "", &buf))
+	assert.Equal([]string{forge.StateError}, f.states)
+	assert.Empty(f.reviews)
+}
+
 func TestIsOC(t *testing.T) {
 	assert.False(t, isOC("abc"))
 	assert.True(t, isOC("abc.mm"))
@@ -245,9 +314,31 @@ func TestFilterLints(t *testing.T) {
 	assert := assert.New(t)
 
 	file := "sdk/v2/x"
-	annotations, filtered := filterLints([]string{"sdk/**"}, []*github.CheckRunAnnotation{
-		&github.CheckRunAnnotation{Path: &file},
+	annotations, filtered := filterLints([]string{"sdk/**"}, []*forge.Annotation{
+		&forge.Annotation{Path: file},
 	})
 	assert.Empty(annotations)
 	assert.Equal(1, filtered)
 }
+
+func TestLimitAnnotations(t *testing.T) {
+	assert := assert.New(t)
+
+	annotations := []*forge.Annotation{
+		&forge.Annotation{Path: "a", Level: forge.LevelNotice},
+		&forge.Annotation{Path: "b", Level: forge.LevelFailure},
+		&forge.Annotation{Path: "c", Level: forge.LevelWarning},
+		&forge.Annotation{Path: "d", Level: forge.LevelFailure},
+	}
+	limited, omitted := limitAnnotations(annotations, 0)
+	assert.Len(limited, 4)
+	assert.Zero(omitted)
+
+	limited, omitted = limitAnnotations(annotations, 3)
+	assert.Equal(1, omitted)
+	paths := make([]string, len(limited))
+	for i, a := range limited {
+		paths[i] = a.Path
+	}
+	assert.Equal([]string{"b", "d", "c"}, paths)
+}
@@ -3,17 +3,34 @@ package checker
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
 	"time"
 
+	"github.com/tengattack/unified-ci/mq"
 	"github.com/tengattack/unified-ci/mq/redis"
+	"github.com/tengattack/unified-ci/mq/sqlite"
 )
 
 // InitMessageQueue for initialize message queue
 func InitMessageQueue() error {
 	LogAccess.Debug("Init Message Queue Engine as ", Conf.MessageQueue.Engine)
+	WorkerID = Conf.Core.WorkerID
+	if WorkerID == "" {
+		hostname, _ := os.Hostname()
+		WorkerID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	LogAccess.Debug("Worker ID: ", WorkerID)
+	mq.LaneLimits = Conf.MessageQueue.LaneLimits
 	switch Conf.MessageQueue.Engine {
 	case "redis":
 		MQ = redis.New(Conf.MessageQueue.Redis)
+	case "sqlite":
+		sqliteConf := Conf.MessageQueue.SQLite
+		if sqliteConf.File == "" {
+			sqliteConf.File = Conf.Core.DBFile
+		}
+		MQ = sqlite.New(sqliteConf)
 	default:
 		LogError.Error("mq error: can't find mq driver")
 		return errors.New("can't find mq driver")
@@ -40,20 +57,36 @@ func StartMessageSubscription(ctx context.Context) {
 		default:
 		}
 		LogAccess.Info("Waiting for message...")
-		message, err := MQ.Subscribe(ctx)
+		message, err := MQ.Subscribe(ctx, WorkerID)
 		if err != nil && err != context.Canceled {
 			LogError.Error("mq subscribe error: " + err.Error())
 			continue
 		}
-		if message == "" {
+		if message == nil {
 			continue
 		}
-		LogAccess.Info("Got message: " + message)
+		LogAccess.Info("Got message: " + message.String())
 
-		err = HandleMessage(ctx, message)
+		job := startJob(message)
+		jobCtx, cancel := context.WithCancel(ctx)
+		interrupted := keepLease(jobCtx, cancel, message)
+		err = HandleMessage(jobCtx, message, job)
+		cancel()
+		switch <-interrupted {
+		case mq.ErrLeaseLost:
+			// the message has been taken over, leave it to its new owner
+			LogError.Error("lease lost, drop result of message: " + message.String())
+			finishJob(job, mq.ErrLeaseLost)
+			continue
+		case mq.ErrSuperseded:
+			LogAccess.Info("Cancel superseded message: " + message.String())
+			job.Conclusion = JobSuperseded
+			err = nil
+		}
+		finishJob(job, err)
 		if err != nil {
 			LogError.Error("handle message error: " + err.Error())
-			err = MQ.Error(message)
+			err = MQ.Error(message, err.Error())
 			if err != nil {
 				LogError.Error("mark message error failed: " + err.Error())
 			}
@@ -67,14 +100,70 @@ func StartMessageSubscription(ctx context.Context) {
 	}
 }
 
-// RetryErrorMessages helps retry error messages
-func RetryErrorMessages(ctx context.Context) {
-	// move pending message to error channel
-	count, _ := MQ.MoveAllPendingToError()
-	if count > 0 {
-		LogAccess.Infof("Move %d pending message(s) to error channel", count)
+// supersedeInterval is how often the running message is checked if it is
+// superseded, it is shorter than the heartbeats so that the newer commit
+// does not wait for the outdated check
+var supersedeInterval = 5 * time.Second
+
+// keepLease sends heartbeats of message until ctx is done, cancel is called
+// if the lease is lost or the message is superseded. The returned channel
+// reports mq.ErrLeaseLost, mq.ErrSuperseded or nil after ctx is done.
+func keepLease(ctx context.Context, cancel context.CancelFunc, message *mq.Message) <-chan error {
+	interrupted := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(mq.LeaseTimeout / 3)
+		defer ticker.Stop()
+		supersedeTicker := time.NewTicker(supersedeInterval)
+		defer supersedeTicker.Stop()
+		for {
+			var err error
+			select {
+			case <-ctx.Done():
+				interrupted <- nil
+				return
+			case <-ticker.C:
+				err = MQ.Heartbeat(message, WorkerID)
+			case <-supersedeTicker.C:
+				var superseded bool
+				superseded, err = MQ.Superseded(message)
+				if superseded {
+					err = mq.ErrSuperseded
+				}
+			}
+			if err == mq.ErrLeaseLost || err == mq.ErrSuperseded {
+				cancel()
+				interrupted <- err
+				return
+			}
+			if err != nil {
+				LogError.Error("mq heartbeat error: " + err.Error())
+			}
+		}
+	}()
+	return interrupted
+}
+
+// ReclaimExpiredMessages moves pending messages whose worker stopped sending
+// heartbeats to error channel
+func ReclaimExpiredMessages(ctx context.Context) {
+	for {
+		count, err := MQ.MoveExpiredPendingToError()
+		if err != nil {
+			LogError.Error("mq reclaim error: " + err.Error())
+		} else if count > 0 {
+			LogAccess.Infof("Move %d expired pending message(s) to error channel", count)
+		}
+		select {
+		case <-ctx.Done():
+			LogAccess.Warn("ReclaimExpiredMessages canceled.")
+			return
+		case <-time.After(mq.LeaseTimeout):
+		}
 	}
+}
 
+// RetryErrorMessages helps retry error messages
+func RetryErrorMessages(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -82,19 +171,43 @@ func RetryErrorMessages(ctx context.Context) {
 			return
 		case <-time.After(60 * time.Second):
 		}
-		s, err := MQ.MoveErrorToPending()
-		if err != nil || len(s) <= 0 {
-			continue
-		}
-		retries, _ := MQ.GetErrorTimes(s)
-		LogAccess.Infof("Retry message: '%s', retries: %d", s, retries)
-		if retries <= Conf.Core.MaxRetries {
-			go retryMessage(s, retries)
+		count, err := MQ.PromoteDueRetries()
+		if err != nil {
+			LogError.Error("mq promote retries error: " + err.Error())
+		} else if count > 0 {
+			LogAccess.Infof("Retry %d message(s)", count)
 		}
+		scheduleErrorMessages()
 	}
 }
 
-func retryMessage(message string, retries int64) {
-	time.Sleep(time.Duration(FibonacciBinet(retries)*60) * time.Second)
-	MQ.Retry(message)
+// scheduleErrorMessages schedules the retries of error messages by their error
+// times, messages exceeding max retries are moved to dead-letter channel
+func scheduleErrorMessages() {
+	for {
+		m, err := MQ.MoveErrorToPending(WorkerID)
+		if err != nil || m == nil {
+			return
+		}
+		superseded, err := MQ.Superseded(m)
+		if err == nil && superseded {
+			LogAccess.Info("Drop superseded message: " + m.String())
+			err = MQ.Finish(m)
+		} else {
+			retries, _ := MQ.GetErrorTimes(m)
+			if retries > Conf.Core.MaxRetries {
+				LogError.Errorf("Message '%s' exceeds max retries, retries: %d", m, retries)
+				err = MQ.Dead(m)
+			} else {
+				due := time.Now().Add(time.Duration(FibonacciBinet(retries)*60) * time.Second)
+				LogAccess.Infof("Schedule message: '%s', retries: %d, due: %s", m, retries, due.Format(time.RFC3339))
+				err = MQ.Schedule(m, due)
+			}
+		}
+		if err != nil {
+			// the message will be reclaimed after its lease expired
+			LogError.Error("mq schedule error: " + err.Error())
+			return
+		}
+	}
 }
@@ -0,0 +1,46 @@
+package checker
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tengattack/unified-ci/mq"
+	"github.com/tengattack/unified-ci/mq/sqlite"
+)
+
+func TestKeepLeaseSuperseded(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fileDB := "queue test.db"
+	q := sqlite.New(sqlite.Config{File: fileDB})
+	require.NoError(q.Init())
+	defer os.Remove(fileDB)
+	defer q.Deinit()
+	MQ = q
+	defer func() { MQ = nil }()
+	interval := supersedeInterval
+	supersedeInterval = 10 * time.Millisecond
+	defer func() { supersedeInterval = interval }()
+
+	m1 := mq.NewPullMessage("owner", "repo", 1, "sha1")
+	require.NoError(q.Push(m1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupted := keepLease(ctx, cancel, m1)
+
+	// noticed before the next heartbeat
+	require.NoError(q.Push(mq.NewPullMessage("owner", "repo", 1, "sha2")))
+	select {
+	case err := <-interrupted:
+		assert.Equal(mq.ErrSuperseded, err)
+	case <-time.After(time.Second):
+		assert.Fail("superseded message is not cancelled")
+	}
+	assert.Equal(context.Canceled, ctx.Err())
+}
@@ -0,0 +1,230 @@
+package checker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	// sarifSrcRoot is the base of the relative artifact URIs
+	sarifSrcRoot = "%SRCROOT%"
+)
+
+// SARIF is the Static Analysis Results Interchange Format (SARIF) log
+type SARIF struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema,omitempty"`
+	Runs    []SARIFRun `json:"runs"`
+}
+
+// SARIFRun is a single run of analysis tool
+type SARIFRun struct {
+	Tool    SARIFTool     `json:"tool"`
+	Results []SARIFResult `json:"results"`
+}
+
+// SARIFTool is the analysis tool
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+// SARIFDriver is the component of analysis tool, it contains the rules
+type SARIFDriver struct {
+	Name  string      `json:"name"`
+	Rules []SARIFRule `json:"rules,omitempty"`
+}
+
+// SARIFRule is the rule of analysis tool
+type SARIFRule struct {
+	ID                   string `json:"id"`
+	DefaultConfiguration *struct {
+		Level string `json:"level,omitempty"`
+	} `json:"defaultConfiguration,omitempty"`
+}
+
+// SARIFResult is a single result of analysis tool
+type SARIFResult struct {
+	RuleID    string          `json:"ruleId,omitempty"`
+	RuleIndex *int            `json:"ruleIndex,omitempty"`
+	Level     string          `json:"level,omitempty"`
+	Message   SARIFMessage    `json:"message"`
+	Locations []SARIFLocation `json:"locations,omitempty"`
+}
+
+// SARIFMessage is the message of result
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+// SARIFLocation is the location of result
+type SARIFLocation struct {
+	PhysicalLocation SARIFPhysicalLocation `json:"physicalLocation"`
+}
+
+// SARIFPhysicalLocation is the location in the artifact
+type SARIFPhysicalLocation struct {
+	ArtifactLocation struct {
+		URI       string `json:"uri"`
+		URIBaseID string `json:"uriBaseId,omitempty"`
+	} `json:"artifactLocation"`
+	Region *SARIFRegion `json:"region,omitempty"`
+}
+
+// SARIFRegion is the region in the artifact, lines and columns start from 1
+type SARIFRegion struct {
+	StartLine   int `json:"startLine,omitempty"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// ParseSARIF parses the SARIF log into lint messages, FilePath is the URI of
+// the first location of result
+func ParseSARIF(out []byte) ([]LintMessage, error) {
+	var log SARIF
+	err := json.Unmarshal(out, &log)
+	if err != nil {
+		return nil, err
+	}
+	var lints []LintMessage
+	for _, run := range log.Runs {
+		rules := run.Tool.Driver.Rules
+		for _, r := range run.Results {
+			lint := LintMessage{
+				RuleID:  r.RuleID,
+				Message: r.Message.Text,
+			}
+			level := r.Level
+			if r.RuleIndex != nil && *r.RuleIndex >= 0 && *r.RuleIndex < len(rules) {
+				rule := rules[*r.RuleIndex]
+				if lint.RuleID == "" {
+					lint.RuleID = rule.ID
+				}
+				if level == "" && rule.DefaultConfiguration != nil {
+					level = rule.DefaultConfiguration.Level
+				}
+			}
+			// the default level of SARIF is warning
+			lint.Severity = lintSeverity(level)
+			if len(r.Locations) > 0 {
+				loc := r.Locations[0].PhysicalLocation
+				lint.FilePath = sarifPath(loc.ArtifactLocation.URI)
+				if loc.Region != nil {
+					lint.Line = loc.Region.StartLine
+					lint.Column = loc.Region.StartColumn
+				}
+			}
+			lints = append(lints, lint)
+		}
+	}
+	return lints, nil
+}
+
+// sarifPath converts the artifact URI to file path
+func sarifPath(uri string) string {
+	uri = strings.TrimPrefix(uri, "file://")
+	if p, err := url.PathUnescape(uri); err == nil {
+		return p
+	}
+	return uri
+}
+
+// sarifLevel returns the SARIF level of severity
+func sarifLevel(severity int) string {
+	switch severity {
+	case severityLevelError:
+		return "error"
+	case severityLevelOff:
+		return "note"
+	}
+	return "warning"
+}
+
+// sarifReport collects the lint messages of linters into SARIF log, it is
+// safe for concurrent use and a nil report collects nothing
+type sarifReport struct {
+	mtx  sync.Mutex
+	runs map[string]*SARIFRun
+}
+
+func newSARIFReport() *sarifReport {
+	return &sarifReport{runs: make(map[string]*SARIFRun)}
+}
+
+// Add adds the lint messages of linter, defaultPath is used for the messages
+// without FilePath
+func (r *sarifReport) Add(linter, defaultPath string, lints []LintMessage) {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	run, ok := r.runs[linter]
+	if !ok {
+		run = &SARIFRun{Results: []SARIFResult{}}
+		run.Tool.Driver.Name = linter
+		r.runs[linter] = run
+	}
+	for _, lint := range lints {
+		result := SARIFResult{
+			RuleID:  lint.RuleID,
+			Level:   sarifLevel(lint.Severity),
+			Message: SARIFMessage{Text: lint.Message},
+		}
+		filePath := lint.FilePath
+		if filePath == "" {
+			filePath = defaultPath
+		}
+		if filePath != "" {
+			var loc SARIFLocation
+			loc.PhysicalLocation.ArtifactLocation.URI = (&url.URL{Path: filePath}).String()
+			loc.PhysicalLocation.ArtifactLocation.URIBaseID = sarifSrcRoot
+			if lint.Line > 0 {
+				region := &SARIFRegion{StartLine: lint.Line}
+				if lint.Formatted {
+					// Column is the number of lines to be formatted
+					region.EndLine = lint.Line + lint.Column - 1
+				} else if lint.Column > 0 {
+					region.StartColumn = lint.Column
+				}
+				loc.PhysicalLocation.Region = region
+			}
+			result.Locations = []SARIFLocation{loc}
+		}
+		run.Results = append(run.Results, result)
+	}
+}
+
+// SARIF returns the SARIF log, the runs are sorted by the names of linters
+func (r *sarifReport) SARIF() SARIF {
+	log := SARIF{Version: sarifVersion, Schema: sarifSchema, Runs: []SARIFRun{}}
+	if r == nil {
+		return log
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	names := make([]string, 0, len(r.runs))
+	for name := range r.runs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		log.Runs = append(log.Runs, *r.runs[name])
+	}
+	return log
+}
+
+// WriteFile writes the SARIF log to file
+func (r *sarifReport) WriteFile(fileName string) error {
+	data, err := json.MarshalIndent(r.SARIF(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, data, 0644)
+}
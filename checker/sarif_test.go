@@ -0,0 +1,73 @@
+package checker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSARIFRules(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	lints, err := ParseSARIF([]byte(`{"version":"2.1.0","runs":[{
+"tool":{"driver":{"name":"gosec","rules":[{"id":"G101","defaultConfiguration":{"level":"error"}}]}},
+"results":[
+  {"ruleIndex":0,"message":{"text":"hardcoded credentials"},
+   "locations":[{"physicalLocation":{"artifactLocation":{"uri":"file:///src/main.go"},"region":{"startLine":3}}}]},
+  {"ruleId":"G104","message":{"text":"unhandled error"}}
+]}]}`))
+	require.NoError(err)
+	assert.Equal([]LintMessage{
+		{FilePath: "/src/main.go", RuleID: "G101", Severity: severityLevelError, Line: 3, Message: "hardcoded credentials"},
+		{RuleID: "G104", Severity: severityLevelWarning, Message: "unhandled error"},
+	}, lints)
+
+	_, err = ParseSARIF([]byte("not json"))
+	assert.Error(err)
+}
+
+func TestSARIFReport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var nilReport *sarifReport
+	nilReport.Add("eslint", "a.js", []LintMessage{{Message: "ignored"}})
+	assert.Empty(nilReport.SARIF().Runs)
+
+	dir, err := ioutil.TempDir("", "sarif")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	lints := []LintMessage{
+		{RuleID: "no-undef", Severity: severityLevelError, Line: 2, Column: 5, Message: "'a' is not defined."},
+		{RuleID: "semi", Severity: severityLevelWarning, Line: 4, Column: 1, Message: "Missing semicolon."},
+	}
+	report := newSARIFReport()
+	report.Add("eslint", "src/a b.js", lints)
+	report.Add("androidlint", "", nil)
+	fileName := filepath.Join(dir, "sha.sarif")
+	require.NoError(report.WriteFile(fileName))
+
+	out, err := ioutil.ReadFile(fileName)
+	require.NoError(err)
+	assert.Contains(string(out), `"version": "2.1.0"`)
+	assert.Contains(string(out), `"uri": "src/a%20b.js"`)
+	assert.Contains(string(out), `"results": []`)
+
+	parsed, err := ParseSARIF(out)
+	require.NoError(err)
+	for i := range lints {
+		lints[i].FilePath = "src/a b.js"
+	}
+	assert.Equal(lints, parsed)
+
+	runs := report.SARIF().Runs
+	require.Len(runs, 2)
+	assert.Equal("androidlint", runs[0].Tool.Driver.Name)
+	assert.Equal("eslint", runs[1].Tool.Driver.Name)
+}
@@ -50,9 +50,26 @@ func routerEngine() *gin.Engine {
 	r.GET("/api/stat/go", api.StatusHandler)
 	r.GET("/api/stat/sys", sysStatsHandler)
 	r.POST(Conf.API.WebHookURI, webhookHandler)
+	if Conf.GitLab.Enabled {
+		r.POST(Conf.GitLab.WebHookURI, gitlabWebhookHandler)
+	}
 	// r.GET("/api/stat/app", appStatusHandler)
 	r.GET("/version", versionHandler)
 	r.GET("/badges/:owner/:repo/:type", badgesHandler)
+	// the jobs carry the errors of checks, which may leak private details
+	r.GET("/api/jobs", AdminMiddleware(), jobsHandler)
+
+	admin := r.Group("/api/admin", AdminMiddleware())
+	admin.GET("/queue/:channel", adminListHandler)
+	admin.POST("/queue/:channel/requeue", adminRequeueHandler)
+	admin.POST("/queue/:channel/drop", adminDropHandler)
+	admin.POST("/queue/:channel/purge", adminPurgeHandler)
+	admin.GET("/deliveries/:id", adminDeliveryHandler)
+	admin.POST("/deliveries/:id/replay", adminReplayHandler)
+	checks := r.Group("/api/checks", AdminMiddleware())
+	checks.POST("", checksHandler)
+	checks.GET("/:id", checkStatusHandler)
+
 	r.GET("/", rootHandler)
 
 	return r
@@ -93,5 +110,8 @@ func RunHTTPServer() (err error) {
 func ShutdownHTTPServer(timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+	if httpSrv == nil {
+		return nil
+	}
 	return httpSrv.Shutdown(ctx)
 }
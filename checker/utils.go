@@ -16,11 +16,11 @@ import (
 	"time"
 
 	"github.com/bmatcuk/doublestar"
-	"github.com/bradleyfalzon/ghinstallation"
 	"github.com/google/go-github/github"
 	shellwords "github.com/mattn/go-shellwords"
 	"github.com/pkg/errors"
 	"github.com/sourcegraph/go-diff/diff"
+	"github.com/tengattack/unified-ci/forge"
 	"github.com/tengattack/unified-ci/util"
 	yaml "gopkg.in/yaml.v2"
 )
@@ -87,72 +87,60 @@ func DoHTTPRequest(req *http.Request, isJSONResponse bool, v interface{}) error
 }
 
 // UpdateCheckRunWithError updates the check run result with error message
-func UpdateCheckRunWithError(ctx context.Context, client *github.Client, gpull *github.PullRequest, checkRunID int64, checkName, outputTitle string, err error) {
-	if gpull != nil {
-		conclusion := "action_required"
-		checkRunStatus := "completed"
-		t := github.Timestamp{Time: time.Now()}
+func UpdateCheckRunWithError(ctx context.Context, f forge.Forge, ref GithubRef, check *forge.Check, outputTitle string, err error) {
+	if check != nil {
 		outputSummary := fmt.Sprintf("error: %v", err)
-
-		owner := gpull.GetBase().GetRepo().GetOwner().GetLogin()
-		repo := gpull.GetBase().GetRepo().GetName()
-		_, _, erro := client.Checks.UpdateCheckRun(ctx, owner, repo, checkRunID, github.UpdateCheckRunOptions{
-			Name:        checkName,
-			Status:      &checkRunStatus,
-			Conclusion:  &conclusion,
-			CompletedAt: &t,
-			Output: &github.CheckRunOutput{
-				Title:   &outputTitle,
-				Summary: &outputSummary,
-			},
+		erro := f.CompleteCheck(ctx, ref.owner, ref.repo, check, forge.ConclusionActionRequired, &forge.CheckOutput{
+			Title:   outputTitle,
+			Summary: outputSummary,
 		})
 		if erro != nil {
-			LogError.Errorf("github update check run with error failed: %v", erro)
+			LogError.Errorf("%s update check run with error failed: %v", f.Name(), erro)
 		}
 	}
 }
 
+// UpdateCheckRunCancelled marks the check run as cancelled, it is called after
+// the context of the check is cancelled so a new context is used
+func UpdateCheckRunCancelled(f forge.Forge, ref GithubRef, check *forge.Check) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	outputTitle := "cancelled"
+	outputSummary := "The check is cancelled, a newer commit may have been pushed."
+	err := UpdateCheckRun(ctx, f, ref, check, forge.ConclusionCancelled, outputTitle, outputSummary, nil)
+	if err != nil {
+		LogError.Errorf("%s update check run as cancelled failed: %v", f.Name(), err)
+	}
+}
+
 // UpdateCheckRun updates the check run result with output message
 // outputTitle, outputSummary can contain markdown.
-func UpdateCheckRun(ctx context.Context, client *github.Client, gpull *github.PullRequest, checkRunID int64, checkName string, conclusion string, t github.Timestamp, outputTitle string, outputSummary string, annotations []*github.CheckRunAnnotation) error {
-	checkRunStatus := "completed"
-	// Only 65535 characters are allowed in this request
-	if len(outputSummary) > 60000 {
-		_, outputSummary = util.Truncated(outputSummary, "... truncated ...", 60000)
-		LogError.Warn("The output summary is too long.")
-	}
-	owner := gpull.GetBase().GetRepo().GetOwner().GetLogin()
-	repo := gpull.GetBase().GetRepo().GetName()
-	_, _, err := client.Checks.UpdateCheckRun(ctx, owner, repo, checkRunID, github.UpdateCheckRunOptions{
-		Name:        checkName,
-		Status:      &checkRunStatus,
-		Conclusion:  &conclusion,
-		CompletedAt: &t,
-		Output: &github.CheckRunOutput{
-			Title:       &outputTitle,
-			Summary:     &outputSummary,
-			Annotations: annotations,
-		},
+func UpdateCheckRun(ctx context.Context, f forge.Forge, ref GithubRef, check *forge.Check, conclusion string, outputTitle string, outputSummary string, annotations []*forge.Annotation) error {
+	err := f.CompleteCheck(ctx, ref.owner, ref.repo, check, conclusion, &forge.CheckOutput{
+		Title:       outputTitle,
+		Summary:     outputSummary,
+		Annotations: annotations,
 	})
 	if err != nil {
-		LogError.Errorf("github update check run failed: %v", err)
+		LogError.Errorf("%s update check run failed: %v", f.Name(), err)
 	}
 	return err
 }
 
-// CreateCheckRun creates a new check run
-func CreateCheckRun(ctx context.Context, client *github.Client, gpull *github.PullRequest, checkName string, ref GithubRef, targetURL string) (*github.CheckRun, error) {
-	checkRunStatus := "in_progress"
-
-	owner := gpull.GetBase().GetRepo().GetOwner().GetLogin()
-	repo := gpull.GetBase().GetRepo().GetName()
-	checkRun, _, err := client.Checks.CreateCheckRun(ctx, owner, repo, github.CreateCheckRunOptions{
-		Name:       checkName,
-		HeadSHA:    ref.Sha,
-		DetailsURL: &targetURL,
-		Status:     &checkRunStatus,
-	})
-	return checkRun, err
+// CreateCheckRun creates a new check run, prNum is zero for branches
+func CreateCheckRun(ctx context.Context, f forge.Forge, ref GithubRef, prNum int, checkName string, targetURL string) (*forge.Check, error) {
+	check := &forge.Check{
+		Name:      checkName,
+		SHA:       ref.Sha,
+		PRNum:     prNum,
+		TargetURL: targetURL,
+	}
+	err := f.CreateCheck(ctx, ref.owner, ref.repo, check)
+	if err != nil {
+		return nil, err
+	}
+	return check, nil
 }
 
 type goTestsConfig struct {
@@ -164,12 +152,22 @@ type projectConfig struct {
 	LinterAfterTests bool                     `yaml:"linterAfterTests"`
 	Tests            map[string]goTestsConfig `yaml:"tests"`
 	IgnorePatterns   []string                 `yaml:"ignorePatterns"`
+	// SkipDraft skips draft pull requests until they are ready for review
+	SkipDraft bool `yaml:"skipDraft"`
+	// Linters are the custom linters by name
+	Linters map[string]customLinterConfig `yaml:"linters"`
+	// FailLevel is the lowest annotation level failing the linter check,
+	// notice, warning or failure (by default)
+	FailLevel string `yaml:"failLevel"`
 }
 
 type projectConfigRaw struct {
-	LinterAfterTests bool                `yaml:"linterAfterTests"`
-	Tests            map[string][]string `yaml:"tests"`
-	IgnorePatterns   []string            `yaml:"ignorePatterns"`
+	LinterAfterTests bool                          `yaml:"linterAfterTests"`
+	Tests            map[string][]string           `yaml:"tests"`
+	IgnorePatterns   []string                      `yaml:"ignorePatterns"`
+	SkipDraft        bool                          `yaml:"skipDraft"`
+	Linters          map[string]customLinterConfig `yaml:"linters"`
+	FailLevel        string                        `yaml:"failLevel"`
 }
 
 func isEmptyTest(cmds []string) bool {
@@ -198,26 +196,31 @@ func readProjectConfig(cwd string) (config projectConfig, err error) {
 		if err != nil {
 			return config, err
 		}
+		config.SkipDraft = cfg.SkipDraft
+		config.Linters = cfg.Linters
+		config.FailLevel = cfg.FailLevel
 		config.Tests = make(map[string]goTestsConfig)
 		for k, v := range cfg.Tests {
 			config.Tests[k] = goTestsConfig{Cmds: v, Coverage: ""}
 		}
 	}
-	return config, nil
+	if _, ok := annotationLevelRanks[config.FailLevel]; config.FailLevel != "" && !ok {
+		return config, fmt.Errorf("unknown failLevel %q", config.FailLevel)
+	}
+	_, err = config.CustomLinters()
+	return config, err
+}
+
+// skipDraft checks if the local repo on forge skips draft pull requests
+func skipDraft(forgeName, owner, repo string) bool {
+	repoConf, err := readProjectConfig(filepath.Join(Conf.Core.WorkDir, repositoryPath(forgeName, owner, repo)))
+	return err == nil && repoConf.SkipDraft
 }
 
 func getDefaultAPIClient(owner string) (*github.Client, error) {
-	var client *github.Client
-	installationID, ok := Conf.GitHub.Installations[owner]
+	installationID, ok := GetInstallationID(owner)
 	if ok {
-		tr, err := ghinstallation.NewKeyFromFile(http.DefaultTransport,
-			Conf.GitHub.AppID, installationID, Conf.GitHub.PrivateKey)
-		if err != nil {
-			return nil, err
-		}
-
-		client = github.NewClient(&http.Client{Transport: tr})
-		return client, nil
+		return util.InstallationClient(installationID)
 	}
 	return nil, errors.New("InstallationID not found, owner: " + owner)
 }
@@ -1,13 +1,17 @@
 package checker
 
 import (
+	"io/ioutil"
+	"os"
 	"path"
+	"path/filepath"
 	"runtime"
 	"testing"
 
 	"github.com/sourcegraph/go-diff/diff"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tengattack/unified-ci/forge"
 )
 
 func TestMatchAny(t *testing.T) {
@@ -37,6 +41,25 @@ func TestReadProjectConfig(t *testing.T) {
 	}, repoConf.IgnorePatterns)
 }
 
+func TestReadProjectConfigFailLevel(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "unified-ci")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, projectTestsConfigFile)
+	require.NoError(ioutil.WriteFile(fileName, []byte("failLevel: warning\n"), 0644))
+	repoConf, err := readProjectConfig(dir)
+	require.NoError(err)
+	assert.Equal(forge.LevelWarning, repoConf.FailLevel)
+
+	require.NoError(ioutil.WriteFile(fileName, []byte("failLevel: error\n"), 0644))
+	_, err = readProjectConfig(dir)
+	assert.EqualError(err, `unknown failLevel "error"`)
+}
+
 func TestNewShellParser(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -121,3 +144,24 @@ func TestParseFileMode(t *testing.T) {
 	require.NoError(err)
 	assert.Equal(0755, mode)
 }
+
+func TestSkipDraft(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	workDir := Conf.Core.WorkDir
+	defer func() { Conf.Core.WorkDir = workDir }()
+	dir, err := ioutil.TempDir("", "unified-ci")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	Conf.Core.WorkDir = dir
+
+	repoPath := filepath.Join(dir, "owner", "repo")
+	require.NoError(os.MkdirAll(repoPath, os.ModePerm))
+	require.NoError(ioutil.WriteFile(filepath.Join(repoPath, projectTestsConfigFile),
+		[]byte("skipDraft: true\n"), 0644))
+
+	assert.True(skipDraft(forge.GitHub, "owner", "repo"))
+	assert.False(skipDraft(forge.GitHub, "owner", "other"))
+	assert.False(skipDraft(forge.GitLab, "owner", "repo"))
+}
@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 
 	mqredis "github.com/tengattack/unified-ci/mq/redis"
+	mqsqlite "github.com/tengattack/unified-ci/mq/sqlite"
 	"gopkg.in/yaml.v2"
 )
 
@@ -12,6 +13,8 @@ type Config struct {
 	Core         SectionCore         `yaml:"core"`
 	API          SectionAPI          `yaml:"api"`
 	GitHub       SectionGitHub       `yaml:"github"`
+	GitLab       SectionGitLab       `yaml:"gitlab"`
+	Gitea        SectionGitea        `yaml:"gitea"`
 	Log          SectionLog          `yaml:"log"`
 	MessageQueue SectionMessageQueue `yaml:"mq"`
 	Concurrency  SectionConcurrency  `yaml:"concurrency"`
@@ -23,21 +26,25 @@ type SectionCore struct {
 	MaxRetries    int64  `yaml:"max_retries"`
 	Socks5Proxy   string `yaml:"socks5_proxy"`
 	GitCommand    string `yaml:"git_command"`
+	WorkerID      string `yaml:"worker_id"`
 	DBFile        string `yaml:"db_file"`
 	WorkDir       string `yaml:"work_dir"`
 	LogsDir       string `yaml:"logs_dir"`
 	CheckLogURI   string `yaml:"check_log_uri"`
-	GolangCILint  string `yaml:"golangcilint"`
-	RemarkLint    string `yaml:"remarklint"`
-	CPPLint       string `yaml:"cpplint"`
-	OCLint        string `yaml:"oclint"`
-	ClangLint     string `yaml:"clanglint"`
-	PHPLint       string `yaml:"phplint"`
-	ESLint        string `yaml:"eslint"`
-	TSLint        string `yaml:"tslint"`
-	SCSSLint      string `yaml:"scsslint"`
-	APIDoc        string `yaml:"apidoc"`
-	AndroidLint   string `yaml:"androidlint"`
+	// MaxAnnotations is the limit of annotations of a check run, 0 for no
+	// limit
+	MaxAnnotations int    `yaml:"max_annotations"`
+	GolangCILint   string `yaml:"golangcilint"`
+	RemarkLint     string `yaml:"remarklint"`
+	CPPLint        string `yaml:"cpplint"`
+	OCLint         string `yaml:"oclint"`
+	ClangLint      string `yaml:"clanglint"`
+	PHPLint        string `yaml:"phplint"`
+	ESLint         string `yaml:"eslint"`
+	TSLint         string `yaml:"tslint"`
+	SCSSLint       string `yaml:"scsslint"`
+	APIDoc         string `yaml:"apidoc"`
+	AndroidLint    string `yaml:"androidlint"`
 }
 
 // SectionAPI is a sub section of config.
@@ -47,6 +54,7 @@ type SectionAPI struct {
 	Address    string `yaml:"address"`
 	Port       int    `yaml:"port"`
 	WebHookURI string `yaml:"webhook_uri"`
+	AdminToken string `yaml:"admin_token"`
 }
 
 // SectionGitHub is a sub section of config.
@@ -55,6 +63,34 @@ type SectionGitHub struct {
 	Secret        string           `yaml:"secret"`
 	PrivateKey    string           `yaml:"private_key"`
 	Installations map[string]int64 `yaml:"installations"`
+	// BaseURL and UploadURL are the endpoints of GitHub Enterprise Server
+	BaseURL   string `yaml:"base_url"`
+	UploadURL string `yaml:"upload_url"`
+	// Branches are the glob patterns of branches to be checked
+	Branches          []string `yaml:"branches"`
+	ProtectedBranches bool     `yaml:"protected_branches"`
+	// RateLimitThreshold is the remaining quota of API requests below which
+	// the watcher waits for the quota reset
+	RateLimitThreshold int `yaml:"rate_limit_threshold"`
+}
+
+// SectionGitLab is a sub section of config.
+type SectionGitLab struct {
+	Enabled bool `yaml:"enabled"`
+	// BaseURL is the API endpoint, e.g. https://gitlab.example.com/api/v4/
+	BaseURL    string `yaml:"base_url"`
+	Token      string `yaml:"token"`
+	Secret     string `yaml:"secret"`
+	WebHookURI string `yaml:"webhook_uri"`
+}
+
+// SectionGitea is a sub section of config.
+type SectionGitea struct {
+	Enabled bool `yaml:"enabled"`
+	// BaseURL is the API endpoint, e.g. https://gitea.example.com/api/v1/
+	BaseURL string `yaml:"base_url"`
+	Token   string `yaml:"token"`
+	Secret  string `yaml:"secret"`
 }
 
 // SectionLog is a sub section of config.
@@ -68,8 +104,10 @@ type SectionLog struct {
 
 // SectionMessageQueue is a sub section of config.
 type SectionMessageQueue struct {
-	Engine string         `yaml:"engine"`
-	Redis  mqredis.Config `yaml:"redis"`
+	Engine     string          `yaml:"engine"`
+	LaneLimits []int           `yaml:"lane_limits"`
+	Redis      mqredis.Config  `yaml:"redis"`
+	SQLite     mqsqlite.Config `yaml:"sqlite"`
 }
 
 // SectionConcurrency is a sub section of config.
@@ -87,10 +125,12 @@ func BuildDefaultConf() Config {
 	conf.Core.MaxRetries = 50
 	conf.Core.Socks5Proxy = ""
 	conf.Core.GitCommand = "git"
+	conf.Core.WorkerID = "" // hostname-pid
 	conf.Core.DBFile = "file.db"
 	conf.Core.WorkDir = "tmp"
 	conf.Core.LogsDir = "logs"
 	conf.Core.CheckLogURI = ""
+	conf.Core.MaxAnnotations = 1000
 	conf.Core.RemarkLint = "remark"
 	conf.Core.CPPLint = "cpplint"
 	conf.Core.ClangLint = "clang-format"
@@ -106,12 +146,31 @@ func BuildDefaultConf() Config {
 	conf.API.Address = ""
 	conf.API.Port = 8098
 	conf.API.WebHookURI = "/api/webhook"
+	conf.API.AdminToken = ""
 
 	// GitHub
 	conf.GitHub.AppID = 0
 	conf.GitHub.Secret = ""
 	conf.GitHub.PrivateKey = ""
 	conf.GitHub.Installations = make(map[string]int64)
+	conf.GitHub.BaseURL = "" // https://api.github.com/
+	conf.GitHub.UploadURL = ""
+	conf.GitHub.Branches = []string{"master"}
+	conf.GitHub.ProtectedBranches = true
+	conf.GitHub.RateLimitThreshold = 500
+
+	// GitLab
+	conf.GitLab.Enabled = false
+	conf.GitLab.BaseURL = "" // https://gitlab.com/api/v4/
+	conf.GitLab.Token = ""
+	conf.GitLab.Secret = ""
+	conf.GitLab.WebHookURI = "/api/gitlab/webhook"
+
+	// Gitea
+	conf.Gitea.Enabled = false
+	conf.Gitea.BaseURL = ""
+	conf.Gitea.Token = ""
+	conf.Gitea.Secret = ""
 
 	// Log
 	conf.Log.Format = "string"
@@ -122,10 +181,12 @@ func BuildDefaultConf() Config {
 
 	// MessageQueue
 	conf.MessageQueue.Engine = "redis"
+	conf.MessageQueue.LaneLimits = []int{10, 10}
 	conf.MessageQueue.Redis.Addr = "localhost:6379"
 	conf.MessageQueue.Redis.Password = ""
 	conf.MessageQueue.Redis.DB = 0
 	conf.MessageQueue.Redis.PoolSize = 10
+	conf.MessageQueue.SQLite.File = "" // same as core.db_file
 
 	// Concurrency
 	conf.Concurrency.Lint = 4
@@ -0,0 +1,135 @@
+package forge
+
+import (
+	"context"
+	"errors"
+)
+
+// Forge names
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+	Gitea  = "gitea"
+)
+
+// States of commit status
+const (
+	StatePending = "pending"
+	StateSuccess = "success"
+	StateError   = "error"
+	StateFailure = "failure"
+)
+
+// Conclusions of check
+const (
+	ConclusionSuccess        = "success"
+	ConclusionFailure        = "failure"
+	ConclusionCancelled      = "cancelled"
+	ConclusionActionRequired = "action_required"
+)
+
+// Levels of annotation
+const (
+	LevelNotice  = "notice"
+	LevelWarning = "warning"
+	LevelFailure = "failure"
+)
+
+// Events of review
+const (
+	ReviewApprove        = "APPROVE"
+	ReviewRequestChanges = "REQUEST_CHANGES"
+	ReviewComment        = "COMMENT"
+)
+
+// ErrUnknownForge is returned when the forge is not configured
+var ErrUnknownForge = errors.New("unknown forge")
+
+// PullRequest is a pull request or merge request
+type PullRequest struct {
+	Number int
+	// State is "open" for the requests can be checked
+	State   string
+	Draft   bool
+	HeadSHA string
+	// BaseSHA is the commit the request is based on
+	BaseSHA string
+	Author  string
+}
+
+// Status is the commit status of a context
+type Status struct {
+	Context     string
+	State       string
+	TargetURL   string
+	Description string
+}
+
+// Annotation is a problem found on the lines of a file
+type Annotation struct {
+	Path      string
+	StartLine int
+	EndLine   int
+	Level     string
+	Message   string
+}
+
+// Check is a named check on a commit, PRNum is zero for branches
+type Check struct {
+	ID        int64
+	Name      string
+	SHA       string
+	PRNum     int
+	TargetURL string
+}
+
+// CheckOutput is the result of a completed check, title and summary can
+// contain markdown
+type CheckOutput struct {
+	Title       string
+	Summary     string
+	Annotations []*Annotation
+}
+
+// Label of pull request
+type Label struct {
+	Name        string
+	Color       string
+	Description string
+}
+
+// Forge is the code hosting service the repositories are checked for
+type Forge interface {
+	// Name returns the name of forge, e.g. github
+	Name() string
+
+	// GetPullRequest gets a single pull request
+	GetPullRequest(ctx context.Context, owner, repo string, number int) (*PullRequest, error)
+	// GetPullRequestDiff gets the unified diff of the pull request
+	GetPullRequestDiff(ctx context.Context, owner, repo string, number int) ([]byte, error)
+	// HasPullRequest checks if the commit still belongs to a pull request
+	HasPullRequest(ctx context.Context, owner, repo, sha string) (bool, error)
+
+	// CloneURL returns the URL to fetch the repository, it carries the
+	// credentials of the checker
+	CloneURL(ctx context.Context, owner, repo string) (string, error)
+	// PullRequestRef returns the ref to fetch the head of pull request
+	PullRequestRef(number int) string
+
+	// CreateStatus creates the commit status
+	CreateStatus(ctx context.Context, owner, repo, sha string, status *Status) error
+	// CreateCheck marks the check as in progress and sets its ID
+	CreateCheck(ctx context.Context, owner, repo string, check *Check) error
+	// CompleteCheck reports the result of the check
+	CompleteCheck(ctx context.Context, owner, repo string, check *Check, conclusion string, output *CheckOutput) error
+	// CreateReview reviews the pull request at commit sha
+	CreateReview(ctx context.Context, owner, repo string, number int, sha, event, body string) error
+
+	// ListLabels lists the label names of pull request
+	ListLabels(ctx context.Context, owner, repo string, number int) ([]string, error)
+	// AddLabel adds the label to pull request, the label is created or
+	// updated as needed
+	AddLabel(ctx context.Context, owner, repo string, number int, label *Label) error
+	// RemoveLabel removes the label from pull request
+	RemoveLabel(ctx context.Context, owner, repo string, number int, name string) error
+}
@@ -0,0 +1,423 @@
+package gitea
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tengattack/unified-ci/forge"
+)
+
+// pageLimit is the number of items per page of list requests, Gitea limits
+// it to 50 by default
+const pageLimit = 50
+
+// maxDescriptionLength is the limit of commit status description
+const maxDescriptionLength = 255
+
+// Forge reports to Gitea or Forgejo with the access token of a bot user
+type Forge struct {
+	// BaseURL is the API endpoint, e.g. https://gitea.example.com/api/v1/
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+var _ forge.Forge = &Forge{}
+
+// New returns the forge of Gitea, http.DefaultClient is used if client is nil
+func New(baseURL, token string, client *http.Client) *Forge {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Forge{BaseURL: baseURL, Token: token, Client: client}
+}
+
+// Error is returned when Gitea responds with an error status
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("gitea: HTTP %d %s", e.StatusCode, e.Message)
+}
+
+// IsStatus checks if err is returned with the status code
+func IsStatus(err error, code int) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == code
+}
+
+// IsWorkInProgress checks if the title marks the pull request as work in
+// progress, which is the draft of Gitea
+func IsWorkInProgress(title string) bool {
+	title = strings.ToUpper(title)
+	return strings.HasPrefix(title, "WIP:") || strings.HasPrefix(title, "[WIP]")
+}
+
+func repoPath(owner, repo string) string {
+	return "repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo)
+}
+
+// raw sends the request with the JSON body and returns the response body
+func (f *Forge) raw(ctx context.Context, method, path string, body interface{}) ([]byte, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, f.BaseURL+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "token "+f.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Message string `json:"message"`
+		}
+		msg := resp.Status
+		if json.Unmarshal(data, &e) == nil && e.Message != "" {
+			msg = e.Message
+		}
+		return nil, &Error{StatusCode: resp.StatusCode, Message: msg}
+	}
+	return data, nil
+}
+
+func (f *Forge) do(ctx context.Context, method, path string, body, v interface{}) error {
+	data, err := f.raw(ctx, method, path, body)
+	if err != nil || v == nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// list walks through the pages of list request until fn returns true
+func (f *Forge) list(ctx context.Context, path string, fn func(item json.RawMessage) (bool, error)) error {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	for page := 1; ; page++ {
+		var items []json.RawMessage
+		err := f.do(ctx, http.MethodGet, fmt.Sprintf("%s%spage=%d&limit=%d", path, sep, page, pageLimit), nil, &items)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			done, err := fn(item)
+			if err != nil || done {
+				return err
+			}
+		}
+		if len(items) < pageLimit {
+			return nil
+		}
+	}
+}
+
+type pullRequest struct {
+	Number    int    `json:"number"`
+	State     string `json:"state"`
+	Title     string `json:"title"`
+	Draft     bool   `json:"draft"`
+	MergeBase string `json:"merge_base"`
+	Head      struct {
+		Sha string `json:"sha"`
+	} `json:"head"`
+	Base struct {
+		Sha string `json:"sha"`
+	} `json:"base"`
+	User struct {
+		Login string `json:"login"`
+	} `json:"user"`
+}
+
+type label struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+}
+
+// Name returns gitea
+func (f *Forge) Name() string {
+	return forge.Gitea
+}
+
+// GetPullRequest gets a single pull request, the pull requests with the
+// work in progress title are drafts
+func (f *Forge) GetPullRequest(ctx context.Context, owner, repo string, number int) (*forge.PullRequest, error) {
+	var pr pullRequest
+	err := f.do(ctx, http.MethodGet, fmt.Sprintf("%s/pulls/%d", repoPath(owner, repo), number), nil, &pr)
+	if err != nil {
+		return nil, err
+	}
+	baseSHA := pr.MergeBase
+	if baseSHA == "" {
+		baseSHA = pr.Base.Sha
+	}
+	return &forge.PullRequest{
+		Number:  pr.Number,
+		State:   pr.State,
+		Draft:   pr.Draft || IsWorkInProgress(pr.Title),
+		HeadSHA: pr.Head.Sha,
+		BaseSHA: baseSHA,
+		Author:  pr.User.Login,
+	}, nil
+}
+
+// GetPullRequestDiff gets the git diff of pull request
+func (f *Forge) GetPullRequestDiff(ctx context.Context, owner, repo string, number int) ([]byte, error) {
+	return f.raw(ctx, http.MethodGet, fmt.Sprintf("%s/pulls/%d.diff", repoPath(owner, repo), number), nil)
+}
+
+// HasPullRequest checks if the commit is the head of an open pull request
+func (f *Forge) HasPullRequest(ctx context.Context, owner, repo, sha string) (bool, error) {
+	found := false
+	err := f.list(ctx, repoPath(owner, repo)+"/pulls?state=open", func(item json.RawMessage) (bool, error) {
+		var pr pullRequest
+		if err := json.Unmarshal(item, &pr); err != nil {
+			return false, err
+		}
+		found = pr.Head.Sha == sha
+		return found, nil
+	})
+	return found, err
+}
+
+// CloneURL returns the clone URL with the access token
+func (f *Forge) CloneURL(ctx context.Context, owner, repo string) (string, error) {
+	u, err := url.Parse(f.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	// e.g. https://gitea.example.com/api/v1/ to https://gitea.example.com/owner/repo.git
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/api/v1") + "/" + owner + "/" + repo + ".git"
+	u.User = url.UserPassword("oauth2", f.Token)
+	return u.String(), nil
+}
+
+// PullRequestRef returns pull/<number>/head
+func (f *Forge) PullRequestRef(number int) string {
+	return "pull/" + strconv.Itoa(number) + "/head"
+}
+
+// checkState maps the conclusions of check to Gitea commit status
+func checkState(conclusion string) string {
+	switch conclusion {
+	case forge.ConclusionSuccess:
+		return forge.StateSuccess
+	case forge.ConclusionCancelled:
+		return forge.StateError
+	}
+	return forge.StateFailure
+}
+
+func (f *Forge) setStatus(ctx context.Context, owner, repo, sha, name, state, targetURL, description string) error {
+	if len(description) > maxDescriptionLength {
+		description = description[:maxDescriptionLength-3] + "..."
+	}
+	body := map[string]string{
+		"state":       state,
+		"context":     name,
+		"description": description,
+		"target_url":  targetURL,
+	}
+	return f.do(ctx, http.MethodPost, fmt.Sprintf("%s/statuses/%s", repoPath(owner, repo), sha), body, nil)
+}
+
+// CreateStatus creates the commit status
+func (f *Forge) CreateStatus(ctx context.Context, owner, repo, sha string, status *forge.Status) error {
+	return f.setStatus(ctx, owner, repo, sha, status.Context, status.State, status.TargetURL, status.Description)
+}
+
+// CreateCheck creates a pending commit status named after the check, as
+// Gitea has no checks
+func (f *Forge) CreateCheck(ctx context.Context, owner, repo string, check *forge.Check) error {
+	return f.setStatus(ctx, owner, repo, check.SHA, check.Name, forge.StatePending, check.TargetURL, "running")
+}
+
+// CompleteCheck completes the commit status of check, and posts the
+// annotations as the inline comments of a pull request review
+func (f *Forge) CompleteCheck(ctx context.Context, owner, repo string, check *forge.Check, conclusion string, output *forge.CheckOutput) error {
+	err := f.setStatus(ctx, owner, repo, check.SHA, check.Name, checkState(conclusion), check.TargetURL, output.Title)
+	if err != nil {
+		return err
+	}
+	if check.PRNum <= 0 || len(output.Annotations) == 0 {
+		return nil
+	}
+	return f.createReviewComments(ctx, owner, repo, check, output)
+}
+
+type review struct {
+	ID       int64  `json:"id"`
+	Body     string `json:"body"`
+	CommitID string `json:"commit_id"`
+}
+
+type reviewComment struct {
+	Path        string `json:"path"`
+	Body        string `json:"body"`
+	NewPosition int    `json:"new_position"`
+}
+
+// hasReview checks if the review has been posted at the commit, so that the
+// comments are not posted again when the check reruns
+func (f *Forge) hasReview(ctx context.Context, owner, repo string, number int, sha, body string) (bool, error) {
+	found := false
+	err := f.list(ctx, fmt.Sprintf("%s/pulls/%d/reviews", repoPath(owner, repo), number), func(item json.RawMessage) (bool, error) {
+		var r review
+		if err := json.Unmarshal(item, &r); err != nil {
+			return false, err
+		}
+		found = r.CommitID == sha && r.Body == body
+		return found, nil
+	})
+	return found, err
+}
+
+func (f *Forge) createReviewComments(ctx context.Context, owner, repo string, check *forge.Check, output *forge.CheckOutput) error {
+	body := fmt.Sprintf("**%s**: %s", check.Name, output.Title)
+	exist, err := f.hasReview(ctx, owner, repo, check.PRNum, check.SHA, body)
+	if err != nil || exist {
+		return err
+	}
+	comments := make([]*reviewComment, len(output.Annotations))
+	for i, a := range output.Annotations {
+		comments[i] = &reviewComment{
+			Path:        a.Path,
+			Body:        fmt.Sprintf("**%s**: %s", a.Level, a.Message),
+			NewPosition: a.StartLine,
+		}
+	}
+	return f.do(ctx, http.MethodPost, fmt.Sprintf("%s/pulls/%d/reviews", repoPath(owner, repo), check.PRNum), map[string]interface{}{
+		"commit_id": check.SHA,
+		"event":     "COMMENT",
+		"body":      body,
+		"comments":  comments,
+	}, nil)
+}
+
+// reviewEvent maps the events of review to Gitea
+func reviewEvent(event string) string {
+	if event == forge.ReviewApprove {
+		return "APPROVED"
+	}
+	return event
+}
+
+// CreateReview reviews the pull request at commit sha
+func (f *Forge) CreateReview(ctx context.Context, owner, repo string, number int, sha, event, body string) error {
+	return f.do(ctx, http.MethodPost, fmt.Sprintf("%s/pulls/%d/reviews", repoPath(owner, repo), number), map[string]string{
+		"commit_id": sha,
+		"event":     reviewEvent(event),
+		"body":      body,
+	}, nil)
+}
+
+func (f *Forge) listIssueLabels(ctx context.Context, owner, repo string, number int) ([]label, error) {
+	var labels []label
+	err := f.do(ctx, http.MethodGet, fmt.Sprintf("%s/issues/%d/labels", repoPath(owner, repo), number), nil, &labels)
+	return labels, err
+}
+
+// ListLabels lists the labels of pull request
+func (f *Forge) ListLabels(ctx context.Context, owner, repo string, number int) ([]string, error) {
+	labels, err := f.listIssueLabels(ctx, owner, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(labels))
+	for i, l := range labels {
+		names[i] = l.Name
+	}
+	return names, nil
+}
+
+// repoLabel gets the repository label, it is created or updated as needed
+func (f *Forge) repoLabel(ctx context.Context, owner, repo string, want *forge.Label) (*label, error) {
+	var found *label
+	err := f.list(ctx, repoPath(owner, repo)+"/labels", func(item json.RawMessage) (bool, error) {
+		var l label
+		if err := json.Unmarshal(item, &l); err != nil {
+			return false, err
+		}
+		if l.Name == want.Name {
+			found = &l
+		}
+		return found != nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]string{
+		"name":        want.Name,
+		"color":       "#" + want.Color,
+		"description": want.Description,
+	}
+	if found == nil {
+		found = new(label)
+		err = f.do(ctx, http.MethodPost, repoPath(owner, repo)+"/labels", body, found)
+		return found, err
+	}
+	if strings.TrimPrefix(found.Color, "#") != want.Color || found.Description != want.Description {
+		err = f.do(ctx, http.MethodPatch, fmt.Sprintf("%s/labels/%d", repoPath(owner, repo), found.ID), body, nil)
+	}
+	return found, err
+}
+
+// AddLabel adds the label to pull request
+func (f *Forge) AddLabel(ctx context.Context, owner, repo string, number int, label *forge.Label) error {
+	l, err := f.repoLabel(ctx, owner, repo, label)
+	if err != nil {
+		return err
+	}
+	return f.do(ctx, http.MethodPost, fmt.Sprintf("%s/issues/%d/labels", repoPath(owner, repo), number),
+		map[string][]int64{"labels": {l.ID}}, nil)
+}
+
+// RemoveLabel removes the label from pull request
+func (f *Forge) RemoveLabel(ctx context.Context, owner, repo string, number int, name string) error {
+	labels, err := f.listIssueLabels(ctx, owner, repo, number)
+	if err != nil {
+		return err
+	}
+	for _, l := range labels {
+		if l.Name == name {
+			return f.do(ctx, http.MethodDelete, fmt.Sprintf("%s/issues/%d/labels/%d", repoPath(owner, repo), number, l.ID), nil, nil)
+		}
+	}
+	return nil
+}
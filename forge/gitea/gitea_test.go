@@ -0,0 +1,225 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tengattack/unified-ci/forge"
+)
+
+func TestPullRequest(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repos/owner/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message":"token is required"}`)
+			return
+		}
+		fmt.Fprint(w, `{"number":1,"state":"open","title":"WIP: feature","merge_base":"base",
+			"head":{"sha":"head"},"base":{"sha":"master"},"user":{"login":"author"}}`)
+	})
+	mux.HandleFunc("/api/v1/repos/owner/repo/pulls/1.diff", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "diff --git a/a.go b/a.go\n")
+	})
+	mux.HandleFunc("/api/v1/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("open", r.URL.Query().Get("state"))
+		fmt.Fprint(w, `[{"number":2,"head":{"sha":"other"}},{"number":1,"head":{"sha":"head"}}]`)
+	})
+	mux.HandleFunc("/api/v1/repos/owner/repo/issues/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":1,"name":"size/XS"},{"id":2,"name":"bug"}]`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	f := New(server.URL+"/api/v1", "token", nil)
+	ctx := context.Background()
+
+	pull, err := f.GetPullRequest(ctx, "owner", "repo", 1)
+	require.NoError(err)
+	assert.Equal(&forge.PullRequest{
+		Number:  1,
+		State:   "open",
+		Draft:   true,
+		HeadSHA: "head",
+		BaseSHA: "base",
+		Author:  "author",
+	}, pull)
+
+	out, err := f.GetPullRequestDiff(ctx, "owner", "repo", 1)
+	require.NoError(err)
+	assert.Equal("diff --git a/a.go b/a.go\n", string(out))
+
+	exist, err := f.HasPullRequest(ctx, "owner", "repo", "head")
+	require.NoError(err)
+	assert.True(exist)
+	exist, err = f.HasPullRequest(ctx, "owner", "repo", "gone")
+	require.NoError(err)
+	assert.False(exist)
+
+	labels, err := f.ListLabels(ctx, "owner", "repo", 1)
+	require.NoError(err)
+	assert.Equal([]string{"size/XS", "bug"}, labels)
+
+	_, err = New(server.URL+"/api/v1", "bad", nil).GetPullRequest(ctx, "owner", "repo", 1)
+	assert.True(IsStatus(err, http.StatusUnauthorized))
+	assert.EqualError(err, "gitea: HTTP 401 token is required")
+
+	cloneURL, err := f.CloneURL(ctx, "owner", "repo")
+	require.NoError(err)
+	assert.Equal(server.URL[:7]+"oauth2:token@"+server.URL[7:]+"/owner/repo.git", cloneURL)
+	assert.Equal("pull/1/head", f.PullRequestRef(1))
+
+	assert.True(IsWorkInProgress("[WIP] feature"))
+	assert.True(IsWorkInProgress("wip: feature"))
+	assert.False(IsWorkInProgress("feature WIP"))
+}
+
+func TestReport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var (
+		statuses []map[string]string
+		reviews  []map[string]interface{}
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repos/owner/repo/statuses/head", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		statuses = append(statuses, body)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/api/v1/repos/owner/repo/statuses/old", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/api/v1/repos/owner/repo/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `[{"id":1,"body":"**linter**: 1 problem(s) found.","commit_id":"old"}]`)
+			return
+		}
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		reviews = append(reviews, body)
+		fmt.Fprint(w, `{}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	f := New(server.URL+"/api/v1/", "token", nil)
+	ctx := context.Background()
+
+	err := f.CreateStatus(ctx, "owner", "repo", "head", &forge.Status{
+		Context: "unified-ci", State: forge.StateError, Description: "failed",
+	})
+	require.NoError(err)
+	require.Len(statuses, 1)
+	assert.Equal("error", statuses[0]["state"])
+	assert.Equal("unified-ci", statuses[0]["context"])
+
+	statuses = nil
+	check := &forge.Check{Name: "linter", SHA: "head", PRNum: 1}
+	require.NoError(f.CreateCheck(ctx, "owner", "repo", check))
+	output := &forge.CheckOutput{
+		Title: "1 problem(s) found.",
+		Annotations: []*forge.Annotation{
+			{Path: "a.go", StartLine: 2, EndLine: 2, Level: forge.LevelWarning, Message: "message"},
+		},
+	}
+	require.NoError(f.CompleteCheck(ctx, "owner", "repo", check, forge.ConclusionFailure, output))
+	require.Len(statuses, 2)
+	assert.Equal("pending", statuses[0]["state"])
+	assert.Equal("failure", statuses[1]["state"])
+	assert.Equal("1 problem(s) found.", statuses[1]["description"])
+	require.Len(reviews, 1)
+	assert.Equal("COMMENT", reviews[0]["event"])
+	assert.Equal("head", reviews[0]["commit_id"])
+	comments, _ := reviews[0]["comments"].([]interface{})
+	require.Len(comments, 1)
+	comment, _ := comments[0].(map[string]interface{})
+	assert.Equal("a.go", comment["path"])
+	assert.EqualValues(2, comment["new_position"])
+	assert.Equal("**warning**: message", comment["body"])
+
+	// the review posted before is skipped
+	reviews = nil
+	check.SHA = "old"
+	require.NoError(f.CompleteCheck(ctx, "owner", "repo", check, forge.ConclusionFailure, output))
+	assert.Empty(reviews)
+
+	require.NoError(f.CreateReview(ctx, "owner", "repo", 1, "head", forge.ReviewApprove, "LGTM"))
+	require.Len(reviews, 1)
+	assert.Equal("APPROVED", reviews[0]["event"])
+}
+
+func TestLabels(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var (
+		added   []interface{}
+		created []map[string]string
+		removed []string
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repos/owner/repo/labels", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `[{"id":1,"name":"size/XS","color":"00ff00"},{"id":3,"name":"size/S","color":"77bb00"}]`)
+			return
+		}
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		created = append(created, body)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":4,"name":"size/M"}`)
+	})
+	mux.HandleFunc("/api/v1/repos/owner/repo/issues/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `[{"id":1,"name":"size/XS"},{"id":2,"name":"bug"}]`)
+			return
+		}
+		var body map[string][]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		added = append(added, body["labels"]...)
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/api/v1/repos/owner/repo/issues/1/labels/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(http.MethodDelete, r.Method)
+		removed = append(removed, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	f := New(server.URL+"/api/v1/", "token", nil)
+	ctx := context.Background()
+
+	require.NoError(f.AddLabel(ctx, "owner", "repo", 1, &forge.Label{Name: "size/S", Color: "77bb00"}))
+	require.NoError(f.AddLabel(ctx, "owner", "repo", 1, &forge.Label{Name: "size/M", Color: "eebb00"}))
+	require.NoError(f.RemoveLabel(ctx, "owner", "repo", 1, "size/XS"))
+	require.NoError(f.RemoveLabel(ctx, "owner", "repo", 1, "unknown"))
+	assert.Equal([]interface{}{float64(3), float64(4)}, added)
+	// size/M is created
+	require.Len(created, 1)
+	assert.Equal("size/M", created[0]["name"])
+	assert.Equal("#eebb00", created[0]["color"])
+	assert.Equal([]string{"/api/v1/repos/owner/repo/issues/1/labels/1"}, removed)
+}
+
+func TestVerifySignature(t *testing.T) {
+	assert := assert.New(t)
+
+	payload := []byte(`{"action":"opened"}`)
+	// echo -n '{"action":"opened"}' | openssl dgst -sha256 -hmac secret
+	const signature = "d42142b53efbc7cf5cd20b6e074eb33707e0de3b368f698e6d6f6c824ffb8d37"
+	assert.True(VerifySignature(payload, signature, "secret"))
+	assert.False(VerifySignature(payload, signature, "wrong"))
+	assert.False(VerifySignature(payload, "not hex", "secret"))
+}
@@ -0,0 +1,54 @@
+package gitea
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Webhook headers and events
+const (
+	HeaderEvent     = "X-Gitea-Event"
+	HeaderSignature = "X-Gitea-Signature"
+	HeaderDelivery  = "X-Gitea-Delivery"
+
+	EventPullRequest = "pull_request"
+)
+
+// PullRequestEvent is the payload of pull request webhook
+type PullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+		Draft  bool   `json:"draft"`
+		Head   struct {
+			Sha string `json:"sha"`
+		} `json:"head"`
+	} `json:"pull_request"`
+	// Changes is set if the pull request is edited
+	Changes struct {
+		Title *struct {
+			From string `json:"from"`
+		} `json:"title"`
+	} `json:"changes"`
+	Repository struct {
+		Name     string `json:"name"`
+		FullName string `json:"full_name"`
+		Owner    struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"repository"`
+}
+
+// VerifySignature checks the HMAC-SHA256 hex signature of webhook payload
+func VerifySignature(payload []byte, signature, secret string) bool {
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
@@ -0,0 +1,230 @@
+package github
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/tengattack/unified-ci/forge"
+	"github.com/tengattack/unified-ci/util"
+)
+
+// maxSummaryLength is the limit of check run output summary, only 65535
+// characters are allowed in the request
+const maxSummaryLength = 60000
+
+// maxAnnotationsPerRequest is the limit of annotations in a request updating
+// the check run, the rest are appended by the successive requests
+const maxAnnotationsPerRequest = 50
+
+// Forge reports to GitHub as a GitHub App installation
+type Forge struct {
+	Client *github.Client
+	// InstallationID is used to fetch repositories, they are fetched without
+	// credentials if it is zero
+	InstallationID int64
+}
+
+var _ forge.Forge = &Forge{}
+
+// New returns the forge of GitHub App installation
+func New(installationID int64) (*Forge, error) {
+	client, err := util.InstallationClient(installationID)
+	if err != nil {
+		return nil, err
+	}
+	return &Forge{Client: client, InstallationID: installationID}, nil
+}
+
+// Name returns github
+func (f *Forge) Name() string {
+	return forge.GitHub
+}
+
+// GetPullRequest gets a single pull request
+func (f *Forge) GetPullRequest(ctx context.Context, owner, repo string, number int) (*forge.PullRequest, error) {
+	pull, _, err := f.Client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	baseSHA, err := util.GetBaseSHA(ctx, f.Client, owner, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	return &forge.PullRequest{
+		Number:  pull.GetNumber(),
+		State:   pull.GetState(),
+		Draft:   pull.GetDraft(),
+		HeadSHA: pull.GetHead().GetSHA(),
+		BaseSHA: baseSHA,
+		Author:  pull.GetHead().GetUser().GetLogin(),
+	}, nil
+}
+
+// GetPullRequestDiff gets the diff of the pull request
+func (f *Forge) GetPullRequestDiff(ctx context.Context, owner, repo string, number int) ([]byte, error) {
+	got, _, err := f.Client.PullRequests.GetRaw(ctx, owner, repo, number, github.RawOptions{Type: github.Diff})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(got), nil
+}
+
+// HasPullRequest searches for the pull request of commit
+func (f *Forge) HasPullRequest(ctx context.Context, owner, repo, sha string) (bool, error) {
+	prNum, err := util.SearchGithubPR(ctx, f.Client, owner+"/"+repo, sha)
+	return prNum != 0, err
+}
+
+// CloneURL returns the clone URL with the installation token
+func (f *Forge) CloneURL(ctx context.Context, owner, repo string) (string, error) {
+	cloneURL := util.CloneURL(owner, repo) // e.g. https://github.com/octocat/Hello-World.git
+	if f.InstallationID == 0 {
+		return cloneURL, nil
+	}
+	token, err := util.InstallationToken(ctx, f.InstallationID)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(cloneURL)
+	if err != nil {
+		return "", err
+	}
+	u.User = url.UserPassword("x-access-token", token)
+	return u.String(), nil
+}
+
+// PullRequestRef returns pull/<number>/head
+func (f *Forge) PullRequestRef(number int) string {
+	return "pull/" + strconv.Itoa(number) + "/head"
+}
+
+// CreateStatus creates the commit status
+func (f *Forge) CreateStatus(ctx context.Context, owner, repo, sha string, status *forge.Status) error {
+	input := &github.RepoStatus{
+		Context:     github.String(status.Context),
+		State:       github.String(status.State),
+		TargetURL:   github.String(status.TargetURL),
+		Description: github.String(status.Description),
+	}
+	_, _, err := f.Client.Repositories.CreateStatus(ctx, owner, repo, sha, input)
+	return err
+}
+
+// CreateCheck creates an in progress check run
+func (f *Forge) CreateCheck(ctx context.Context, owner, repo string, check *forge.Check) error {
+	checkRun, _, err := f.Client.Checks.CreateCheckRun(ctx, owner, repo, github.CreateCheckRunOptions{
+		Name:       check.Name,
+		HeadSHA:    check.SHA,
+		DetailsURL: github.String(check.TargetURL),
+		Status:     github.String("in_progress"),
+	})
+	if err != nil {
+		return err
+	}
+	check.ID = checkRun.GetID()
+	return nil
+}
+
+// CompleteCheck completes the check run with output, the annotations are
+// sent in pages of maxAnnotationsPerRequest
+func (f *Forge) CompleteCheck(ctx context.Context, owner, repo string, check *forge.Check, conclusion string, output *forge.CheckOutput) error {
+	summary := output.Summary
+	if len(summary) > maxSummaryLength {
+		_, summary = util.Truncated(summary, "... truncated ...", maxSummaryLength)
+	}
+	annotations := make([]*github.CheckRunAnnotation, 0, len(output.Annotations))
+	for _, a := range output.Annotations {
+		annotations = append(annotations, &github.CheckRunAnnotation{
+			Path:            github.String(a.Path),
+			StartLine:       github.Int(a.StartLine),
+			EndLine:         github.Int(a.EndLine),
+			AnnotationLevel: github.String(a.Level),
+			Message:         github.String(a.Message),
+		})
+	}
+	// the check run is completed by the request of the last page
+	for {
+		n := len(annotations)
+		if n > maxAnnotationsPerRequest {
+			n = maxAnnotationsPerRequest
+		}
+		opts := github.UpdateCheckRunOptions{
+			Name: check.Name,
+			Output: &github.CheckRunOutput{
+				Title:       github.String(output.Title),
+				Summary:     github.String(summary),
+				Annotations: annotations[:n],
+			},
+		}
+		annotations = annotations[n:]
+		if len(annotations) == 0 {
+			opts.Status = github.String("completed")
+			opts.Conclusion = github.String(conclusion)
+			opts.CompletedAt = &github.Timestamp{Time: time.Now()}
+		}
+		_, _, err := f.Client.Checks.UpdateCheckRun(ctx, owner, repo, check.ID, opts)
+		if err != nil || len(annotations) == 0 {
+			return err
+		}
+	}
+}
+
+// CreateReview creates a new review on the pull request
+func (f *Forge) CreateReview(ctx context.Context, owner, repo string, number int, sha, event, body string) error {
+	input := &github.PullRequestReviewRequest{
+		CommitID: github.String(sha),
+		Body:     github.String(body),
+		Event:    github.String(event),
+	}
+	_, _, err := f.Client.PullRequests.CreateReview(ctx, owner, repo, number, input)
+	return err
+}
+
+// ListLabels lists the labels of pull request
+func (f *Forge) ListLabels(ctx context.Context, owner, repo string, number int) ([]string, error) {
+	var names []string
+	opts := &github.ListOptions{}
+	for {
+		ls, resp, err := f.Client.Issues.ListLabelsByIssue(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range ls {
+			names = append(names, l.GetName())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return names, nil
+}
+
+// AddLabel adds the label to pull request, and updates its color and
+// description if they differ
+func (f *Forge) AddLabel(ctx context.Context, owner, repo string, number int, label *forge.Label) error {
+	labels, _, err := f.Client.Issues.AddLabelsToIssue(ctx, owner, repo, number, []string{label.Name})
+	if err != nil {
+		return err
+	}
+	for _, l := range labels {
+		if l.GetName() == label.Name {
+			if l.GetColor() != label.Color || l.GetDescription() != label.Description {
+				l.Color = github.String(label.Color)
+				l.Description = github.String(label.Description)
+				_, _, err = f.Client.Issues.EditLabel(ctx, owner, repo, l.GetName(), l)
+			}
+			break
+		}
+	}
+	return err
+}
+
+// RemoveLabel removes the label from pull request
+func (f *Forge) RemoveLabel(ctx context.Context, owner, repo string, number int, name string) error {
+	_, err := f.Client.Issues.RemoveLabelForIssue(ctx, owner, repo, number, name)
+	return err
+}
@@ -0,0 +1,97 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tengattack/unified-ci/forge"
+)
+
+func TestCheck(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var (
+		output   github.CheckRunOutput
+		statuses []string
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":7}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/check-runs/7", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Status *string               `json:"status"`
+			Output github.CheckRunOutput `json:"output"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		output = body.Output
+		if body.Status != nil {
+			statuses = append(statuses, *body.Status)
+		} else {
+			statuses = append(statuses, "")
+		}
+		fmt.Fprint(w, `{"id":7}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/issues/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name":"size/XS"},{"name":"bug"}]`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	f := &Forge{Client: client}
+	ctx := context.Background()
+
+	check := &forge.Check{Name: "linter", SHA: "sha", PRNum: 1}
+	require.NoError(f.CreateCheck(ctx, "owner", "repo", check))
+	assert.EqualValues(7, check.ID)
+
+	err := f.CompleteCheck(ctx, "owner", "repo", check, forge.ConclusionFailure, &forge.CheckOutput{
+		Title:   "1 problem(s) found.",
+		Summary: "summary",
+		Annotations: []*forge.Annotation{
+			{Path: "a.go", StartLine: 1, EndLine: 2, Level: forge.LevelWarning, Message: "message"},
+		},
+	})
+	require.NoError(err)
+	assert.Equal("1 problem(s) found.", output.GetTitle())
+	require.Len(output.Annotations, 1)
+	assert.Equal("a.go", output.Annotations[0].GetPath())
+	assert.Equal(2, output.Annotations[0].GetEndLine())
+	assert.Equal(forge.LevelWarning, output.Annotations[0].GetAnnotationLevel())
+	assert.Equal([]string{"completed"}, statuses)
+
+	// the annotations are paged
+	statuses = nil
+	annotations := make([]*forge.Annotation, 120)
+	for i := range annotations {
+		annotations[i] = &forge.Annotation{Path: "a.go", StartLine: i + 1, EndLine: i + 1, Level: forge.LevelNotice, Message: "message"}
+	}
+	err = f.CompleteCheck(ctx, "owner", "repo", check, forge.ConclusionSuccess, &forge.CheckOutput{
+		Title:       "No problems found.",
+		Summary:     "summary",
+		Annotations: annotations,
+	})
+	require.NoError(err)
+	assert.Equal([]string{"", "", "completed"}, statuses)
+	require.Len(output.Annotations, 20)
+	assert.Equal(101, output.Annotations[0].GetStartLine())
+
+	labels, err := f.ListLabels(ctx, "owner", "repo", 1)
+	require.NoError(err)
+	assert.Equal([]string{"size/XS", "bug"}, labels)
+
+	cloneURL, err := f.CloneURL(ctx, "owner", "repo")
+	require.NoError(err)
+	assert.Equal("https://github.com/owner/repo.git", cloneURL)
+	assert.Equal("pull/1/head", f.PullRequestRef(1))
+}
@@ -0,0 +1,453 @@
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tengattack/unified-ci/forge"
+)
+
+// DefaultBaseURL is the API endpoint of gitlab.com
+const DefaultBaseURL = "https://gitlab.com/api/v4/"
+
+// maxDescriptionLength is the limit of commit status description
+const maxDescriptionLength = 255
+
+// Forge reports to GitLab with a personal, project or group access token
+type Forge struct {
+	// BaseURL is the API endpoint, e.g. https://gitlab.example.com/api/v4/
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+var _ forge.Forge = &Forge{}
+
+// New returns the forge of GitLab, http.DefaultClient is used if client is nil
+func New(baseURL, token string, client *http.Client) *Forge {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Forge{BaseURL: baseURL, Token: token, Client: client}
+}
+
+// Error is returned when GitLab responds with an error status
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("gitlab: HTTP %d %s", e.StatusCode, e.Message)
+}
+
+// IsStatus checks if err is returned with the status code
+func IsStatus(err error, code int) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == code
+}
+
+// SplitPath splits the full path of project into namespace and name, the
+// namespace may contain subgroups
+func SplitPath(path string) (owner, repo string) {
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return "", path
+	}
+	return path[:i], path[i+1:]
+}
+
+// projectPath returns the URL-encoded path of project used as its ID
+func projectPath(owner, repo string) string {
+	return "projects/" + url.QueryEscape(owner+"/"+repo)
+}
+
+func (f *Forge) do(ctx context.Context, method, path string, body, v interface{}) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, f.BaseURL+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("PRIVATE-TOKEN", f.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Message interface{} `json:"message"`
+			Error   string      `json:"error"`
+		}
+		msg := resp.Status
+		if json.Unmarshal(data, &e) == nil {
+			if e.Message != nil {
+				msg = fmt.Sprint(e.Message)
+			} else if e.Error != "" {
+				msg = e.Error
+			}
+		}
+		return resp, &Error{StatusCode: resp.StatusCode, Message: msg}
+	}
+	if v != nil {
+		err = json.Unmarshal(data, v)
+	}
+	return resp, err
+}
+
+type diffRefs struct {
+	BaseSHA  string `json:"base_sha"`
+	HeadSHA  string `json:"head_sha"`
+	StartSHA string `json:"start_sha"`
+}
+
+type mergeRequest struct {
+	IID            int      `json:"iid"`
+	State          string   `json:"state"`
+	Draft          bool     `json:"draft"`
+	WorkInProgress bool     `json:"work_in_progress"`
+	SHA            string   `json:"sha"`
+	DiffRefs       diffRefs `json:"diff_refs"`
+	Labels         []string `json:"labels"`
+	Author         struct {
+		Username string `json:"username"`
+	} `json:"author"`
+}
+
+func (f *Forge) getMergeRequest(ctx context.Context, owner, repo string, number int) (*mergeRequest, error) {
+	var mr mergeRequest
+	_, err := f.do(ctx, http.MethodGet, fmt.Sprintf("%s/merge_requests/%d", projectPath(owner, repo), number), nil, &mr)
+	if err != nil {
+		return nil, err
+	}
+	return &mr, nil
+}
+
+// Name returns gitlab
+func (f *Forge) Name() string {
+	return forge.GitLab
+}
+
+// GetPullRequest gets a single merge request, the state "opened" is reported
+// as "open"
+func (f *Forge) GetPullRequest(ctx context.Context, owner, repo string, number int) (*forge.PullRequest, error) {
+	mr, err := f.getMergeRequest(ctx, owner, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	state := mr.State
+	if state == "opened" {
+		state = "open"
+	}
+	return &forge.PullRequest{
+		Number:  mr.IID,
+		State:   state,
+		Draft:   mr.Draft || mr.WorkInProgress,
+		HeadSHA: mr.SHA,
+		BaseSHA: mr.DiffRefs.BaseSHA,
+		Author:  mr.Author.Username,
+	}, nil
+}
+
+// GetPullRequestDiff rebuilds the git diff of merge request from its changes
+func (f *Forge) GetPullRequestDiff(ctx context.Context, owner, repo string, number int) ([]byte, error) {
+	var mr struct {
+		Changes []struct {
+			OldPath     string `json:"old_path"`
+			NewPath     string `json:"new_path"`
+			AMode       string `json:"a_mode"`
+			BMode       string `json:"b_mode"`
+			NewFile     bool   `json:"new_file"`
+			DeletedFile bool   `json:"deleted_file"`
+			Diff        string `json:"diff"`
+		} `json:"changes"`
+	}
+	_, err := f.do(ctx, http.MethodGet, fmt.Sprintf("%s/merge_requests/%d/changes", projectPath(owner, repo), number), nil, &mr)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, c := range mr.Changes {
+		oldName, newName := "a/"+c.OldPath, "b/"+c.NewPath
+		buf.WriteString(fmt.Sprintf("diff --git %s %s\n", oldName, newName))
+		if c.NewFile {
+			oldName = "/dev/null"
+			buf.WriteString("new file mode " + c.BMode + "\n")
+		} else if c.DeletedFile {
+			newName = "/dev/null"
+			buf.WriteString("deleted file mode " + c.AMode + "\n")
+		} else {
+			buf.WriteString("index 0000000..0000000 " + c.BMode + "\n")
+		}
+		if c.Diff == "" {
+			continue
+		}
+		buf.WriteString("--- " + oldName + "\n")
+		buf.WriteString("+++ " + newName + "\n")
+		buf.WriteString(c.Diff)
+		if !strings.HasSuffix(c.Diff, "\n") {
+			buf.WriteString("\n")
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// HasPullRequest checks if the commit belongs to an opened merge request
+func (f *Forge) HasPullRequest(ctx context.Context, owner, repo, sha string) (bool, error) {
+	var mrs []mergeRequest
+	_, err := f.do(ctx, http.MethodGet, fmt.Sprintf("%s/repository/commits/%s/merge_requests", projectPath(owner, repo), sha), nil, &mrs)
+	if err != nil {
+		return false, err
+	}
+	for _, mr := range mrs {
+		if mr.State == "opened" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CloneURL returns the clone URL with the access token
+func (f *Forge) CloneURL(ctx context.Context, owner, repo string) (string, error) {
+	u, err := url.Parse(f.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	// e.g. https://gitlab.com/api/v4/ to https://gitlab.com/group/project.git
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/api/v4") + "/" + owner + "/" + repo + ".git"
+	u.User = url.UserPassword("oauth2", f.Token)
+	return u.String(), nil
+}
+
+// PullRequestRef returns merge-requests/<number>/head
+func (f *Forge) PullRequestRef(number int) string {
+	return "merge-requests/" + strconv.Itoa(number) + "/head"
+}
+
+// commitState maps the states of commit status to GitLab
+func commitState(state string) string {
+	switch state {
+	case forge.StateError, forge.StateFailure:
+		return "failed"
+	}
+	return state
+}
+
+// checkState maps the conclusions of check to GitLab commit status
+func checkState(conclusion string) string {
+	switch conclusion {
+	case forge.ConclusionSuccess:
+		return "success"
+	case forge.ConclusionCancelled:
+		return "canceled"
+	}
+	return "failed"
+}
+
+func (f *Forge) setStatus(ctx context.Context, owner, repo, sha, name, state, targetURL, description string) error {
+	if len(description) > maxDescriptionLength {
+		description = description[:maxDescriptionLength-3] + "..."
+	}
+	body := map[string]string{
+		"state":       state,
+		"name":        name,
+		"description": description,
+	}
+	if targetURL != "" {
+		body["target_url"] = targetURL
+	}
+	_, err := f.do(ctx, http.MethodPost, fmt.Sprintf("%s/statuses/%s", projectPath(owner, repo), sha), body, nil)
+	return err
+}
+
+// CreateStatus creates the commit status
+func (f *Forge) CreateStatus(ctx context.Context, owner, repo, sha string, status *forge.Status) error {
+	return f.setStatus(ctx, owner, repo, sha, status.Context, commitState(status.State), status.TargetURL, status.Description)
+}
+
+// CreateCheck creates a running commit status named after the check, as
+// GitLab has no checks
+func (f *Forge) CreateCheck(ctx context.Context, owner, repo string, check *forge.Check) error {
+	return f.setStatus(ctx, owner, repo, check.SHA, check.Name, "running", check.TargetURL, "running")
+}
+
+// CompleteCheck completes the commit status of check, and starts a
+// discussion on the merge request for each annotation
+func (f *Forge) CompleteCheck(ctx context.Context, owner, repo string, check *forge.Check, conclusion string, output *forge.CheckOutput) error {
+	err := f.setStatus(ctx, owner, repo, check.SHA, check.Name, checkState(conclusion), check.TargetURL, output.Title)
+	if err != nil {
+		return err
+	}
+	if check.PRNum <= 0 || len(output.Annotations) == 0 {
+		return nil
+	}
+	return f.createDiscussions(ctx, owner, repo, check.PRNum, output.Annotations)
+}
+
+type position struct {
+	PositionType string `json:"position_type"`
+	BaseSHA      string `json:"base_sha"`
+	StartSHA     string `json:"start_sha"`
+	HeadSHA      string `json:"head_sha"`
+	NewPath      string `json:"new_path"`
+	NewLine      int    `json:"new_line"`
+}
+
+type discussion struct {
+	Notes []struct {
+		Body     string    `json:"body"`
+		Position *position `json:"position"`
+	} `json:"notes"`
+}
+
+func discussionKey(path string, line int, body string) string {
+	return path + ":" + strconv.Itoa(line) + ":" + body
+}
+
+// listDiscussionKeys lists the positioned notes of merge request, so that
+// the annotations are not posted again when the check reruns
+func (f *Forge) listDiscussionKeys(ctx context.Context, owner, repo string, number int) (map[string]bool, error) {
+	keys := make(map[string]bool)
+	page := "1"
+	for page != "" {
+		var discussions []discussion
+		resp, err := f.do(ctx, http.MethodGet, fmt.Sprintf("%s/merge_requests/%d/discussions?per_page=100&page=%s",
+			projectPath(owner, repo), number, page), nil, &discussions)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range discussions {
+			for _, n := range d.Notes {
+				if n.Position != nil {
+					keys[discussionKey(n.Position.NewPath, n.Position.NewLine, n.Body)] = true
+				}
+			}
+		}
+		page = resp.Header.Get("X-Next-Page")
+	}
+	return keys, nil
+}
+
+func (f *Forge) createDiscussions(ctx context.Context, owner, repo string, number int, annotations []*forge.Annotation) error {
+	mr, err := f.getMergeRequest(ctx, owner, repo, number)
+	if err != nil {
+		return err
+	}
+	keys, err := f.listDiscussionKeys(ctx, owner, repo, number)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, a := range annotations {
+		body := fmt.Sprintf("**%s**: %s", a.Level, a.Message)
+		if keys[discussionKey(a.Path, a.StartLine, body)] {
+			continue
+		}
+		input := map[string]interface{}{
+			"body": body,
+			"position": &position{
+				PositionType: "text",
+				BaseSHA:      mr.DiffRefs.BaseSHA,
+				StartSHA:     mr.DiffRefs.StartSHA,
+				HeadSHA:      mr.DiffRefs.HeadSHA,
+				NewPath:      a.Path,
+				NewLine:      a.StartLine,
+			},
+		}
+		_, err = f.do(ctx, http.MethodPost, fmt.Sprintf("%s/merge_requests/%d/discussions", projectPath(owner, repo), number), input, nil)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// CreateReview comments on the merge request, and approves it or revokes
+// the approval according to event
+func (f *Forge) CreateReview(ctx context.Context, owner, repo string, number int, sha, event, body string) error {
+	mrPath := fmt.Sprintf("%s/merge_requests/%d", projectPath(owner, repo), number)
+	_, err := f.do(ctx, http.MethodPost, mrPath+"/notes", map[string]string{"body": body}, nil)
+	if err != nil {
+		return err
+	}
+	switch event {
+	case forge.ReviewApprove:
+		_, err = f.do(ctx, http.MethodPost, mrPath+"/approve", map[string]string{"sha": sha}, nil)
+		if IsStatus(err, http.StatusUnauthorized) {
+			// already approved
+			err = nil
+		}
+	case forge.ReviewRequestChanges:
+		_, err = f.do(ctx, http.MethodPost, mrPath+"/unapprove", nil, nil)
+		if IsStatus(err, http.StatusNotFound) {
+			// not approved yet
+			err = nil
+		}
+	}
+	return err
+}
+
+// ListLabels lists the labels of merge request
+func (f *Forge) ListLabels(ctx context.Context, owner, repo string, number int) ([]string, error) {
+	mr, err := f.getMergeRequest(ctx, owner, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	return mr.Labels, nil
+}
+
+// AddLabel creates the project label if it does not exist, and adds it to
+// the merge request
+func (f *Forge) AddLabel(ctx context.Context, owner, repo string, number int, label *forge.Label) error {
+	_, err := f.do(ctx, http.MethodPost, projectPath(owner, repo)+"/labels", map[string]string{
+		"name":        label.Name,
+		"color":       "#" + label.Color,
+		"description": label.Description,
+	}, nil)
+	if err != nil && !IsStatus(err, http.StatusConflict) {
+		return err
+	}
+	_, err = f.do(ctx, http.MethodPut, fmt.Sprintf("%s/merge_requests/%d", projectPath(owner, repo), number),
+		map[string]string{"add_labels": label.Name}, nil)
+	return err
+}
+
+// RemoveLabel removes the label from merge request
+func (f *Forge) RemoveLabel(ctx context.Context, owner, repo string, number int, name string) error {
+	_, err := f.do(ctx, http.MethodPut, fmt.Sprintf("%s/merge_requests/%d", projectPath(owner, repo), number),
+		map[string]string{"remove_labels": name}, nil)
+	return err
+}
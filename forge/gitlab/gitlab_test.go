@@ -0,0 +1,187 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sourcegraph/go-diff/diff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tengattack/unified-ci/forge"
+)
+
+type request struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+// fakeGitLab records the requests and responds to the merge request 1 of
+// project group/sub/repo
+func fakeGitLab() (*httptest.Server, func() []request) {
+	var (
+		mu       sync.Mutex
+		requests []request
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		req := request{Method: r.Method, Path: r.URL.EscapedPath()}
+		data, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &req.Body)
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+
+		const project = "/api/v4/projects/group%2Fsub%2Frepo"
+		switch req.Method + " " + req.Path {
+		case "GET " + project + "/merge_requests/1":
+			w.Write([]byte(`{"iid":1,"state":"opened","draft":true,"sha":"head",
+				"diff_refs":{"base_sha":"base","head_sha":"head","start_sha":"start"},
+				"labels":["size/XS","bug"],"author":{"username":"author"}}`))
+		case "GET " + project + "/merge_requests/1/changes":
+			w.Write([]byte(`{"changes":[
+				{"old_path":"a.go","new_path":"a.go","a_mode":"100644","b_mode":"100644","diff":"@@ -1 +1,2 @@\n package a\n+// A\n"},
+				{"old_path":"b.sh","new_path":"b.sh","a_mode":"0","b_mode":"100755","new_file":true,"diff":"@@ -0,0 +1 @@\n+#!/bin/sh\n"}]}`))
+		case "GET " + project + "/repository/commits/head/merge_requests":
+			w.Write([]byte(`[{"iid":1,"state":"opened"}]`))
+		case "GET " + project + "/merge_requests/1/discussions":
+			w.Write([]byte(`[{"notes":[{"body":"**warning**: old","position":{"new_path":"a.go","new_line":2}}]}]`))
+		case "POST " + project + "/labels":
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"message":"Label already exists"}`))
+		case "POST " + project + "/merge_requests/1/unapprove":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"404 Not Found"}`))
+		default:
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+		}
+	})
+	ts := httptest.NewServer(mux)
+	return ts, func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		r := requests
+		requests = nil
+		return r
+	}
+}
+
+func TestMergeRequest(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ts, requests := fakeGitLab()
+	defer ts.Close()
+	f := New(ts.URL+"/api/v4", "token", nil)
+	ctx := context.Background()
+
+	owner, repo := SplitPath("group/sub/repo")
+	assert.Equal("group/sub", owner)
+	assert.Equal("repo", repo)
+
+	pull, err := f.GetPullRequest(ctx, owner, repo, 1)
+	require.NoError(err)
+	assert.Equal(&forge.PullRequest{
+		Number:  1,
+		State:   "open",
+		Draft:   true,
+		HeadSHA: "head",
+		BaseSHA: "base",
+		Author:  "author",
+	}, pull)
+
+	exist, err := f.HasPullRequest(ctx, owner, repo, "head")
+	require.NoError(err)
+	assert.True(exist)
+
+	out, err := f.GetPullRequestDiff(ctx, owner, repo, 1)
+	require.NoError(err)
+	diffs, err := diff.ParseMultiFileDiff(out)
+	require.NoError(err)
+	require.Len(diffs, 2)
+	assert.Equal("b/a.go", diffs[0].NewName)
+	assert.EqualValues(2, diffs[0].Hunks[0].NewLines)
+	assert.Equal("/dev/null", diffs[1].OrigName)
+	assert.Contains(diffs[1].Extended, "new file mode 100755")
+
+	labels, err := f.ListLabels(ctx, owner, repo, 1)
+	require.NoError(err)
+	assert.Equal([]string{"size/XS", "bug"}, labels)
+
+	_, err = New(ts.URL+"/api/v4", "bad", nil).GetPullRequest(ctx, owner, repo, 1)
+	assert.True(IsStatus(err, http.StatusUnauthorized))
+
+	cloneURL, err := f.CloneURL(ctx, owner, repo)
+	require.NoError(err)
+	assert.Equal(ts.URL[:7]+"oauth2:token@"+ts.URL[7:]+"/group/sub/repo.git", cloneURL)
+	assert.Equal("merge-requests/1/head", f.PullRequestRef(1))
+	requests()
+}
+
+func TestReport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ts, requests := fakeGitLab()
+	defer ts.Close()
+	f := New(ts.URL+"/api/v4/", "token", nil)
+	ctx := context.Background()
+	const project = "/api/v4/projects/group%2Fsub%2Frepo"
+
+	err := f.CreateStatus(ctx, "group/sub", "repo", "head", &forge.Status{
+		Context: "unified-ci", State: forge.StateError, Description: "failed",
+	})
+	require.NoError(err)
+	r := requests()
+	require.Len(r, 1)
+	assert.Equal(project+"/statuses/head", r[0].Path)
+	assert.Equal("failed", r[0].Body["state"])
+	assert.Equal("unified-ci", r[0].Body["name"])
+
+	check := &forge.Check{Name: "linter", SHA: "head", PRNum: 1}
+	require.NoError(f.CreateCheck(ctx, "group/sub", "repo", check))
+	err = f.CompleteCheck(ctx, "group/sub", "repo", check, forge.ConclusionFailure, &forge.CheckOutput{
+		Title: "2 problem(s) found.",
+		Annotations: []*forge.Annotation{
+			{Path: "a.go", StartLine: 2, EndLine: 2, Level: forge.LevelWarning, Message: "old"},
+			{Path: "a.go", StartLine: 2, EndLine: 2, Level: forge.LevelWarning, Message: "new"},
+		},
+	})
+	require.NoError(err)
+	r = requests()
+	require.Len(r, 5)
+	assert.Equal("running", r[0].Body["state"])
+	assert.Equal("failed", r[1].Body["state"])
+	assert.Equal("2 problem(s) found.", r[1].Body["description"])
+	// the annotation posted before is skipped
+	assert.Equal("POST", r[4].Method)
+	assert.Equal(project+"/merge_requests/1/discussions", r[4].Path)
+	assert.Equal("**warning**: new", r[4].Body["body"])
+	position, _ := r[4].Body["position"].(map[string]interface{})
+	assert.Equal("start", position["start_sha"])
+	assert.EqualValues(2, position["new_line"])
+
+	require.NoError(f.CreateReview(ctx, "group/sub", "repo", 1, "head", forge.ReviewRequestChanges, "body"))
+	r = requests()
+	require.Len(r, 2)
+	assert.Equal(project+"/merge_requests/1/notes", r[0].Path)
+	assert.Equal(project+"/merge_requests/1/unapprove", r[1].Path)
+
+	require.NoError(f.AddLabel(ctx, "group/sub", "repo", 1, &forge.Label{Name: "size/S", Color: "77bb00"}))
+	require.NoError(f.RemoveLabel(ctx, "group/sub", "repo", 1, "size/XS"))
+	r = requests()
+	require.Len(r, 3)
+	assert.Equal("#77bb00", r[0].Body["color"])
+	assert.Equal("size/S", r[1].Body["add_labels"])
+	assert.Equal("size/XS", r[2].Body["remove_labels"])
+}
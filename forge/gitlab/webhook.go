@@ -0,0 +1,44 @@
+package gitlab
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// Webhook headers and events
+const (
+	HeaderEvent = "X-Gitlab-Event"
+	HeaderToken = "X-Gitlab-Token"
+
+	EventMergeRequest = "Merge Request Hook"
+)
+
+// MergeRequestEvent is the payload of merge request webhook
+type MergeRequestEvent struct {
+	ObjectKind string `json:"object_kind"`
+	User       struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	Project struct {
+		ID                int64  `json:"id"`
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		IID            int    `json:"iid"`
+		State          string `json:"state"`
+		Action         string `json:"action"`
+		Draft          bool   `json:"draft"`
+		WorkInProgress bool   `json:"work_in_progress"`
+		// Oldrev is set if the update pushes new commits
+		Oldrev     string `json:"oldrev"`
+		LastCommit struct {
+			ID string `json:"id"`
+		} `json:"last_commit"`
+	} `json:"object_attributes"`
+}
+
+// VerifyToken checks the secret token of webhook request
+func VerifyToken(req *http.Request, secret string) bool {
+	token := req.Header.Get(HeaderToken)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
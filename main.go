@@ -2,11 +2,9 @@ package main
 
 import (
 	"context"
-	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -16,7 +14,6 @@ import (
 	"github.com/tengattack/unified-ci/config"
 	"github.com/tengattack/unified-ci/store"
 	"github.com/tengattack/unified-ci/util"
-	"golang.org/x/net/proxy"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -27,10 +24,16 @@ var (
 
 func main() {
 	checker.SetVersion(Version)
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		runCheck(os.Args[2:])
+		return
+	}
+
 	configPath := flag.String("config", "", "config file")
 	showHelp := flag.Bool("help", false, "show help message")
 	showVerbose := flag.Bool("verbose", false, "show verbose debug log")
 	showVersion := flag.Bool("version", false, "show version")
+	workerOnly := flag.Bool("worker", false, "only process messages from the queue")
 	flag.Parse()
 
 	if *showHelp {
@@ -59,22 +62,20 @@ func main() {
 
 	// set default parameters.
 	checker.Conf = conf
+	checker.WorkerOnly = *workerOnly
 
 	if err = checker.InitLog(conf); err != nil {
 		log.Fatalf("error: %v", err)
 	}
 
-	var tr http.RoundTripper
-	if checker.Conf.Core.Socks5Proxy != "" {
-		dialSocksProxy, err := proxy.SOCKS5("tcp", checker.Conf.Core.Socks5Proxy, nil, proxy.Direct)
-		if err != nil {
-			msg := "Setup proxy failed: " + err.Error()
-			err = errors.New(msg)
-			log.Fatalf("error: %v", err)
-		}
-		tr = &http.Transport{Dial: dialSocksProxy.Dial}
+	tr, err := util.NewTransport(checker.Conf.Core.Socks5Proxy)
+	if err != nil {
+		log.Fatalf("error: %v", err)
 	}
 
+	if err = util.SetGitHubURLs(conf.GitHub.BaseURL, conf.GitHub.UploadURL); err != nil {
+		log.Fatalf("error: %v", err)
+	}
 	if err = util.InitJWTClient(conf.GitHub.AppID, conf.GitHub.PrivateKey, tr); err != nil {
 		log.Fatalf("error: %v", err)
 	}
@@ -88,12 +89,17 @@ func main() {
 		log.Fatalf("error: %v", err)
 	}
 
+	if err = checker.DiscoverInstallations(context.Background()); err != nil {
+		// installations are still updated by webhook events
+		checker.LogError.Errorf("Discover installations error: %v", err)
+	}
+
 	parent, cancel := context.WithCancel(context.Background())
 	g, ctx := errgroup.WithContext(parent)
 
 	leave := make(chan struct{})
 	go func() {
-		if checker.Conf.Core.EnableRetries {
+		if checker.Conf.Core.EnableRetries && !*workerOnly {
 			g.Go(func() error {
 				// Start error message retries
 				checker.RetryErrorMessages(ctx)
@@ -102,20 +108,34 @@ func main() {
 		}
 
 		g.Go(func() error {
-			// Start message subscription
-			checker.StartMessageSubscription(ctx)
+			// Start expired message reclaiming
+			checker.ReclaimExpiredMessages(ctx)
 			return nil
 		})
 
 		g.Go(func() error {
-			// Run httpd server
-			return checker.RunHTTPServer()
+			// Start message subscription
+			checker.StartMessageSubscription(ctx)
+			return nil
 		})
 
-		g.Go(func() error {
-			// Run local repo watcher
-			return checker.WatchLocalRepo(ctx)
-		})
+		if !*workerOnly {
+			g.Go(func() error {
+				// Run httpd server
+				return checker.RunHTTPServer()
+			})
+
+			g.Go(func() error {
+				// Run local repo watcher
+				return checker.WatchLocalRepo(ctx)
+			})
+
+			g.Go(func() error {
+				// Record the jobs reported by workers
+				checker.SyncJobReports(ctx)
+				return nil
+			})
+		}
 
 		if err = g.Wait(); err != nil {
 			checker.LogError.Error(err)
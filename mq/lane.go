@@ -0,0 +1,62 @@
+package mq
+
+import "strconv"
+
+// Message priorities, each priority has its own lane in queue and workers
+// always drain the higher lanes first
+const (
+	// PriorityPush is for interactive pull request pushes
+	PriorityPush = iota
+	// PriorityRerun is for re-requested checks
+	PriorityRerun
+	// PriorityBackground is for background branch scans
+	PriorityBackground
+
+	// LaneCount is the number of lanes
+	LaneCount
+)
+
+// LaneLimits is the max number of messages taken from each lane in a row
+// while the lower lanes are waiting, 0 means no limit
+var LaneLimits = []int{10, 10}
+
+// Lane returns the lane of message
+func (m *Message) Lane() int {
+	if m.Priority < 0 {
+		return PriorityPush
+	}
+	if m.Priority >= LaneCount {
+		return PriorityBackground
+	}
+	return m.Priority
+}
+
+// LaneKey returns the key name of the lane, the highest lane is
+// SyncChannelKey so that the messages pushed by earlier versions are kept
+func LaneKey(lane int) string {
+	if lane == PriorityPush {
+		return SyncChannelKey
+	}
+	return SyncChannelKey + ":lane" + strconv.Itoa(lane)
+}
+
+// PickLane returns the lane to take message from by the number of messages
+// in each lane and the number of messages taken from each lane in a row,
+// -1 is returned if all lanes are empty
+func PickLane(sizes []int64, served []int64, limits []int) int {
+	for i, size := range sizes {
+		if size <= 0 {
+			continue
+		}
+		if i < len(limits) && limits[i] > 0 && i < len(served) && served[i] >= int64(limits[i]) {
+			// give way to the lower lanes
+			for j := i + 1; j < len(sizes); j++ {
+				if sizes[j] > 0 {
+					return j
+				}
+			}
+		}
+		return i
+	}
+	return -1
+}
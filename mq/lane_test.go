@@ -0,0 +1,33 @@
+package mq
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPickLane(t *testing.T) {
+	assert := assert.New(t)
+
+	limits := []int{2, 2}
+	assert.Equal(-1, PickLane([]int64{0, 0, 0}, []int64{0, 0, 0}, limits))
+	assert.Equal(0, PickLane([]int64{1, 1, 1}, []int64{0, 0, 0}, limits))
+	assert.Equal(1, PickLane([]int64{0, 1, 1}, []int64{5, 0, 0}, limits))
+	// the higher lanes give way when they reach the limits
+	assert.Equal(1, PickLane([]int64{1, 1, 1}, []int64{2, 0, 0}, limits))
+	assert.Equal(2, PickLane([]int64{1, 0, 1}, []int64{2, 0, 0}, limits))
+	assert.Equal(2, PickLane([]int64{0, 1, 1}, []int64{0, 2, 0}, limits))
+	// unless nothing is waiting below
+	assert.Equal(0, PickLane([]int64{1, 0, 0}, []int64{2, 0, 0}, limits))
+	// no limit
+	assert.Equal(0, PickLane([]int64{1, 1, 1}, []int64{100, 0, 0}, []int{0, 0}))
+
+	m := NewTreeMessage("owner", "repo", "master", "sha")
+	assert.Equal(PriorityPush, m.Lane())
+	assert.Equal(SyncChannelKey, LaneKey(m.Lane()))
+	m.Priority = PriorityBackground
+	assert.Equal(PriorityBackground, m.Lane())
+	assert.Equal("checker:channel:lane2", LaneKey(m.Lane()))
+	m.Priority = 99
+	assert.Equal(PriorityBackground, m.Lane())
+}
@@ -0,0 +1,217 @@
+package mq
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Checks of message, a single test is named as `test:<name>`
+const (
+	CheckLint = "lint"
+	CheckTest = "test"
+)
+
+// MessageVersion is the current version of message envelope
+const MessageVersion = 1
+
+// Message types
+const (
+	TypePull = "pull"
+	TypeTree = "tree"
+)
+
+// Message is the job envelope carried by the message queue
+type Message struct {
+	Version int    `json:"v"`
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Owner   string `json:"owner"`
+	Repo    string `json:"repo"`
+	PRNum   int    `json:"pr,omitempty"`
+	Branch  string `json:"branch,omitempty"`
+	Sha     string `json:"sha"`
+	// Forge hosts the repository, it is empty for GitHub
+	Forge string `json:"forge,omitempty"`
+
+	Event      string   `json:"event,omitempty"`
+	Checks     []string `json:"checks,omitempty"`
+	DeliveryID string   `json:"delivery_id,omitempty"`
+	Priority   int      `json:"priority,omitempty"`
+	CreateTime int64    `json:"create_time,omitempty"`
+
+	// raw is the exact string stored in the queue backend
+	raw string
+}
+
+// NewID generates a random message ID
+func NewID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NewPullMessage returns a message for checking the head commit of a pull request
+func NewPullMessage(owner, repo string, prNum int, sha string) *Message {
+	return &Message{
+		Version:    MessageVersion,
+		ID:         NewID(),
+		Type:       TypePull,
+		Owner:      owner,
+		Repo:       repo,
+		PRNum:      prNum,
+		Sha:        sha,
+		CreateTime: time.Now().Unix(),
+	}
+}
+
+// NewTreeMessage returns a message for checking the head commit of a branch
+func NewTreeMessage(owner, repo, branch, sha string) *Message {
+	return &Message{
+		Version:    MessageVersion,
+		ID:         NewID(),
+		Type:       TypeTree,
+		Owner:      owner,
+		Repo:       repo,
+		Branch:     branch,
+		Sha:        sha,
+		CreateTime: time.Now().Unix(),
+	}
+}
+
+// ParseMessage parses the message stored in the queue backend, both of the
+// JSON envelope and the legacy `owner/repo/pull/N/commits/sha` form are
+// accepted. The returned message is never nil, so that a malformed message
+// can still be finished or dropped by its raw form.
+func ParseMessage(s string) (*Message, error) {
+	m := &Message{raw: s}
+	if strings.HasPrefix(s, "{") {
+		err := json.Unmarshal([]byte(s), m)
+		if err != nil {
+			return m, err
+		}
+		if m.Version > MessageVersion {
+			return m, fmt.Errorf("unsupported message version: %d", m.Version)
+		}
+		return m, m.Validate()
+	}
+
+	// legacy form: owner/repo/pull/N/commits/sha or owner/repo/tree/branch/commits/sha
+	parts := strings.Split(s, "/")
+	if len(parts) != 6 || (parts[2] != TypePull && parts[2] != TypeTree) || parts[4] != "commits" {
+		return m, errors.New("malformed message: " + s)
+	}
+	m.Owner = parts[0]
+	m.Repo = parts[1]
+	m.Type = parts[2]
+	m.Sha = parts[5]
+	if m.Type == TypePull {
+		prNum, err := strconv.Atoi(parts[3])
+		if err != nil {
+			return m, errors.New("malformed message: " + s)
+		}
+		m.PRNum = prNum
+	} else {
+		m.Branch = parts[3]
+	}
+	return m, m.Validate()
+}
+
+// Validate checks the required fields of message
+func (m *Message) Validate() error {
+	if m.Owner == "" || m.Repo == "" || m.Sha == "" {
+		return errors.New("malformed message: missing owner, repo or sha")
+	}
+	switch m.Type {
+	case TypePull:
+		if m.PRNum <= 0 {
+			return errors.New("malformed message: invalid pull request number")
+		}
+	case TypeTree:
+		if m.Branch == "" {
+			return errors.New("malformed message: missing branch")
+		}
+	default:
+		return errors.New("malformed message: unknown type " + m.Type)
+	}
+	return nil
+}
+
+// Key identifies the commit to be checked, messages with the same key
+// check the same thing
+func (m *Message) Key() string {
+	if m.Type == TypeTree {
+		return fmt.Sprintf("%s%s/%s/tree/%s/commits/%s", m.forgePrefix(), m.Owner, m.Repo, m.Branch, m.Sha)
+	}
+	if m.Type == TypePull {
+		return m.PullKey() + "/commits/" + m.Sha
+	}
+	return m.raw
+}
+
+// PullKey identifies the pull request of a pull message, it is empty for
+// other messages
+func (m *Message) PullKey() string {
+	if m.Type != TypePull {
+		return ""
+	}
+	return fmt.Sprintf("%s%s/%s/pull/%d", m.forgePrefix(), m.Owner, m.Repo, m.PRNum)
+}
+
+// forgePrefix distinguishes the keys of repositories on other forges
+func (m *Message) forgePrefix() string {
+	if m.Forge == "" {
+		return ""
+	}
+	return m.Forge + ":"
+}
+
+// Restricted checks if only some of the checks are requested, the overall
+// result of commit is unknown for such message
+func (m *Message) Restricted() bool {
+	return len(m.Checks) > 0
+}
+
+// LintRequested checks if linters should run, all checks run if Checks is empty
+func (m *Message) LintRequested() bool {
+	if len(m.Checks) == 0 {
+		return true
+	}
+	for _, check := range m.Checks {
+		if check == CheckLint {
+			return true
+		}
+	}
+	return false
+}
+
+// TestRequested checks if the test should run, all checks run if Checks is
+// empty
+func (m *Message) TestRequested(name string) bool {
+	if len(m.Checks) == 0 {
+		return true
+	}
+	for _, check := range m.Checks {
+		if check == CheckTest || check == CheckTest+":"+name {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the raw form of message stored in the queue backend
+func (m *Message) String() string {
+	if m.raw == "" {
+		if m.Version == 0 {
+			m.Version = MessageVersion
+		}
+		b, _ := json.Marshal(m)
+		m.raw = string(b)
+	}
+	return m.raw
+}
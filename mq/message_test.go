@@ -0,0 +1,92 @@
+package mq
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMessage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// legacy form
+	m, err := ParseMessage("owner/repo/pull/12/commits/sha")
+	require.NoError(err)
+	assert.Equal(TypePull, m.Type)
+	assert.Equal("owner", m.Owner)
+	assert.Equal("repo", m.Repo)
+	assert.Equal(12, m.PRNum)
+	assert.Equal("sha", m.Sha)
+	assert.Equal("owner/repo/pull/12/commits/sha", m.Key())
+	assert.Equal("owner/repo/pull/12", m.PullKey())
+	// raw form is kept as is
+	assert.Equal("owner/repo/pull/12/commits/sha", m.String())
+
+	m, err = ParseMessage("owner/repo/tree/master/commits/sha")
+	require.NoError(err)
+	assert.Equal(TypeTree, m.Type)
+	assert.Equal("master", m.Branch)
+	assert.Empty(m.PullKey())
+
+	for _, s := range []string{
+		"owner/repo/pull/x/commits/sha",
+		"owner/repo/issues/1/commits/sha",
+		"owner/repo/pull/1/sha",
+		`{"v":1,"type":"pull","owner":"owner","repo":"repo","sha":"sha"}`,
+		`{"v":99,"type":"pull","owner":"owner","repo":"repo","pr":1,"sha":"sha"}`,
+		`{"v":1,`,
+	} {
+		m, err = ParseMessage(s)
+		assert.Error(err, s)
+		require.NotNil(m)
+		assert.Equal(s, m.String())
+	}
+
+	// JSON envelope
+	m = NewTreeMessage("owner", "repo", "release/1.0", "sha")
+	m.Event = "push"
+	m.Checks = []string{"lint"}
+	m2, err := ParseMessage(m.String())
+	require.NoError(err)
+	assert.Equal(m.ID, m2.ID)
+	assert.Equal(MessageVersion, m2.Version)
+	assert.Equal("release/1.0", m2.Branch)
+	assert.Equal("push", m2.Event)
+	assert.Equal([]string{"lint"}, m2.Checks)
+	assert.Equal("owner/repo/tree/release/1.0/commits/sha", m2.Key())
+	assert.Equal(m.String(), m2.String())
+
+	// repositories on other forges
+	m = NewPullMessage("group/subgroup", "repo", 3, "sha")
+	m.Forge = "gitlab"
+	m2, err = ParseMessage(m.String())
+	require.NoError(err)
+	assert.Equal("gitlab", m2.Forge)
+	assert.Equal("gitlab:group/subgroup/repo/pull/3/commits/sha", m2.Key())
+	assert.Equal("gitlab:group/subgroup/repo/pull/3", m2.PullKey())
+}
+
+func TestMessageChecks(t *testing.T) {
+	assert := assert.New(t)
+
+	m := NewPullMessage("owner", "repo", 1, "sha")
+	assert.False(m.Restricted())
+	assert.True(m.LintRequested())
+	assert.True(m.TestRequested("unit"))
+
+	m.Checks = []string{CheckLint}
+	assert.True(m.Restricted())
+	assert.True(m.LintRequested())
+	assert.False(m.TestRequested("unit"))
+
+	m.Checks = []string{CheckTest}
+	assert.False(m.LintRequested())
+	assert.True(m.TestRequested("unit"))
+
+	m.Checks = []string{CheckTest + ":unit"}
+	assert.False(m.LintRequested())
+	assert.True(m.TestRequested("unit"))
+	assert.False(m.TestRequested("e2e"))
+}
@@ -1,6 +1,10 @@
 package mq
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
 const (
 	// SyncChannelKey is key name for sync message channel
@@ -12,20 +16,142 @@ const (
 	SyncErrorChannelKey = "checker:channel:error"
 	// SyncRetriesChannelKey is key name for store sync error times
 	SyncRetriesChannelKey = "checker:channel:retries"
+	// SyncErrorsChannelKey is key name for store the last error of messages
+	SyncErrorsChannelKey = "checker:channel:errors"
+	// SyncLeasesChannelKey is key name for store the leases of pending messages
+	SyncLeasesChannelKey = "checker:channel:leases"
+	// SyncHeadsChannelKey is key name for store the latest commit of pull requests
+	SyncHeadsChannelKey = "checker:channel:heads"
+	// SyncScheduledChannelKey is key name for error messages scheduled to be
+	// retried, scored by the due time
+	SyncScheduledChannelKey = "checker:channel:scheduled"
+	// SyncDeadChannelKey is key name for messages exceeding max retries
+	SyncDeadChannelKey = "checker:channel:dead"
+	// SyncIndexChannelKey is key name for store the number of messages of each
+	// message key in all channels
+	SyncIndexChannelKey = "checker:channel:index"
+	// SyncQueuedChannelKey is key name for store the last pushed message of
+	// pull requests
+	SyncQueuedChannelKey = "checker:channel:queued"
+	// SyncServedChannelKey is key name for store the number of messages taken
+	// from each lane in a row
+	SyncServedChannelKey = "checker:channel:served"
+	// SyncJobsChannelKey is key name for the states of jobs reported by
+	// workers
+	SyncJobsChannelKey = "checker:channel:jobs"
 )
 
+// Channels of the queue
+const (
+	ChannelQueue     = "queue"
+	ChannelPending   = "pending"
+	ChannelError     = "error"
+	ChannelScheduled = "scheduled"
+	ChannelDead      = "dead"
+)
+
+// Channels lists all channels of the queue
+var Channels = []string{ChannelQueue, ChannelPending, ChannelError, ChannelScheduled, ChannelDead}
+
+// ErrUnknownChannel is returned when the channel is not one of Channels
+var ErrUnknownChannel = errors.New("unknown channel")
+
+// LeaseTimeout is how long a pending message belongs to its worker after
+// the last heartbeat
+const LeaseTimeout = 90 * time.Second
+
+// ErrLeaseLost is returned by Heartbeat when the message is no longer leased
+// by the worker, e.g. it has been moved to error channel after its lease expired
+var ErrLeaseLost = errors.New("lease lost")
+
+// ErrNotFound is returned when the message is not in the channel
+var ErrNotFound = errors.New("message not found")
+
+// ErrSuperseded is returned by Heartbeat when a newer commit of the same pull
+// request has been pushed
+var ErrSuperseded = errors.New("superseded by a newer commit")
+
+// Lease records the worker processing a pending message
+type Lease struct {
+	WorkerID string `json:"worker"`
+	Expire   int64  `json:"expire"`
+}
+
+// NewLease returns a lease of worker starting from now
+func NewLease(workerID string) *Lease {
+	return &Lease{
+		WorkerID: workerID,
+		Expire:   time.Now().Add(LeaseTimeout).Unix(),
+	}
+}
+
+// Expired checks if the lease is expired at t
+func (l *Lease) Expired(t time.Time) bool {
+	return l.Expire < t.Unix()
+}
+
+// Entry is a message in a channel with its error state
+type Entry struct {
+	Message   *Message
+	Retries   int64
+	LastError string
+	// Due is the time a scheduled message will be retried
+	Due time.Time
+}
+
 // MessageQueue interface
 type MessageQueue interface {
 	Init() error
 	Reset()
-	Push(message string) error
-	Subscribe(ctx context.Context) (string, error)
-	Finish(message string) error
-	Error(message string) error
-	MoveAllPendingToError() (int, error)
-	MoveErrorToPending() (string, error)
-	GetErrorTimes(message string) (int64, error)
-	Retry(message string) error
-
-	Exists(message string) (bool, error)
+	// Push adds message to queue, a pull message becomes the head of its pull
+	// request and drops the queued messages of older commits
+	Push(message *Message) error
+	// Subscribe claims a message from queue and leases it to the worker
+	Subscribe(ctx context.Context, workerID string) (*Message, error)
+	// Heartbeat extends the lease of a pending message, ErrSuperseded is
+	// returned if the message is no longer the head of its pull request
+	Heartbeat(message *Message, workerID string) error
+	Finish(message *Message) error
+	// Error moves the message from pending channel to error channel, and
+	// records the reason as its last error
+	Error(message *Message, reason string) error
+	// MoveExpiredPendingToError moves pending messages whose lease expired
+	// to error channel
+	MoveExpiredPendingToError() (int, error)
+	// MoveErrorToPending moves the oldest error message to pending channel
+	// and leases it to the worker
+	MoveErrorToPending(workerID string) (*Message, error)
+	GetErrorTimes(message *Message) (int64, error)
+	Retry(message *Message) error
+	// Schedule moves the message from pending channel to be retried at due
+	Schedule(message *Message, due time.Time) error
+	// PromoteDueRetries moves the scheduled messages whose due time has passed
+	// to queue
+	PromoteDueRetries() (int, error)
+	// Dead moves the message from pending channel to dead-letter channel
+	Dead(message *Message) error
+	// List returns the messages in channel, the oldest first
+	List(channel string) ([]*Entry, error)
+	// Requeue moves the message from channel to queue and clears its error
+	// times, ErrNotFound is returned if the message is not in channel
+	Requeue(channel string, message *Message) error
+	// Drop removes the message from channel, ErrNotFound is returned if the
+	// message is not in channel
+	Drop(channel string, message *Message) error
+	// Purge removes all messages from channel, the removed messages are
+	// returned
+	Purge(channel string) ([]*Message, error)
+
+	// Exists checks if a message with the same key is in the queue
+	Exists(message *Message) (bool, error)
+	// Superseded checks if a newer commit of the same pull request has been
+	// pushed
+	Superseded(message *Message) (bool, error)
+
+	// ReportJob records the state of a job changed by a worker, so that the
+	// server records the jobs of all workers
+	ReportJob(state []byte) error
+	// PopJobReports removes at most n states recorded by ReportJob and returns
+	// them, the oldest first
+	PopJobReports(n int) ([][]byte, error)
 }
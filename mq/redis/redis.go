@@ -2,6 +2,7 @@ package redis
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"strconv"
 	"time"
@@ -13,6 +14,10 @@ import (
 //
 var redisClient *redis.Client
 
+// pollInterval is the interval Subscribe looks at the lanes when all of them
+// are empty
+const pollInterval = time.Second
+
 // Config redis message queue
 type Config struct {
 	Addr     string `yaml:"addr"`
@@ -51,84 +56,259 @@ func (s *MessageQueue) Init() error {
 		return err
 	}
 
+	return buildIndex()
+}
+
+// buildIndex builds the index of message keys for the messages pushed by
+// earlier versions, which have no index
+func buildIndex() error {
+	exists, err := redisClient.Exists(mq.SyncIndexChannelKey).Result()
+	if err != nil || exists {
+		return err
+	}
+	index := make(map[string]int64)
+	for _, channel := range append(laneKeys(), mq.SyncPendingChannelKey, mq.SyncErrorChannelKey, mq.SyncDeadChannelKey) {
+		list, err := redisClient.LRange(channel, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		for _, v := range list {
+			m, _ := mq.ParseMessage(v)
+			index[m.Key()]++
+		}
+	}
+	list, err := redisClient.ZRange(mq.SyncScheduledChannelKey, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for _, v := range list {
+		m, _ := mq.ParseMessage(v)
+		index[m.Key()]++
+	}
+	for key, n := range index {
+		_, err = redisClient.HIncrBy(mq.SyncIndexChannelKey, key, n).Result()
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func runInt(script *redis.Script, keys []string, args ...interface{}) (int64, error) {
+	v, err := script.Run(redisClient, keys, args...).Result()
+	if err != nil {
+		return 0, err
+	}
+	n, _ := v.(int64)
+	return n, nil
+}
+
+func laneKeys() []string {
+	keys := make([]string, mq.LaneCount)
+	for i := range keys {
+		keys[i] = mq.LaneKey(i)
+	}
+	return keys
+}
+
+// channelKeys returns the key names of channel, queue has a key for each lane
+func channelKeys(channel string) ([]string, error) {
+	switch channel {
+	case mq.ChannelQueue:
+		return laneKeys(), nil
+	case mq.ChannelPending:
+		return []string{mq.SyncPendingChannelKey}, nil
+	case mq.ChannelError:
+		return []string{mq.SyncErrorChannelKey}, nil
+	case mq.ChannelScheduled:
+		return []string{mq.SyncScheduledChannelKey}, nil
+	case mq.ChannelDead:
+		return []string{mq.SyncDeadChannelKey}, nil
+	}
+	return nil, mq.ErrUnknownChannel
+}
+
 // Reset client message queue.
 func (s *MessageQueue) Reset() {
-	redisClient.Del(mq.SyncChannelKey)
+	_, _ = s.Purge(mq.ChannelQueue)
 }
 
 // Push message to queue
-func (s *MessageQueue) Push(message string) error {
-	_, err := redisClient.LPush(mq.SyncChannelKey, message).Result()
+func (s *MessageQueue) Push(message *mq.Message) error {
+	keys := []string{mq.LaneKey(message.Lane()), mq.SyncIndexChannelKey, mq.SyncHeadsChannelKey, mq.SyncQueuedChannelKey}
+	_, err := pushScript.Run(redisClient, append(keys, laneKeys()...),
+		message.String(), message.Key(), message.PullKey(), message.Sha).Result()
 	return err
 }
 
 // Subscribe message from queue.
-func (s *MessageQueue) Subscribe(ctx context.Context) (string, error) {
+func (s *MessageQueue) Subscribe(ctx context.Context, workerID string) (*mq.Message, error) {
 	for {
 		select {
 		case <-ctx.Done():
-			return "", ctx.Err()
+			return nil, ctx.Err()
 		default:
 		}
-		msg, err := redisClient.BRPopLPush(mq.SyncChannelKey, mq.SyncPendingChannelKey, 5*time.Second).Result()
-		// If timeout is reached, a redis.Nil will be returned
-		if err == redis.Nil {
-			continue
+		msg, err := claim(workerID)
+		if err != nil {
+			return nil, err
 		}
+		if msg != "" {
+			// malformed messages are still returned to be finished by the handler
+			message, _ := mq.ParseMessage(msg)
+			return message, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// claim takes a message from the lanes and leases it to the worker, an empty
+// string is returned if there is no message
+func claim(workerID string) (string, error) {
+	keys := laneKeys()
+	sizes := make([]int64, len(keys))
+	for i, key := range keys {
+		size, err := redisClient.LLen(key).Result()
 		if err != nil {
 			return "", err
 		}
-		return msg, nil
+		sizes[i] = size
+	}
+	fields := make([]string, len(keys))
+	for i := range fields {
+		fields[i] = strconv.Itoa(i)
+	}
+	values, err := redisClient.HMGet(mq.SyncServedChannelKey, fields...).Result()
+	if err != nil {
+		return "", err
+	}
+	served := make([]int64, len(keys))
+	for i, v := range values {
+		if str, ok := v.(string); ok {
+			served[i], _ = strconv.ParseInt(str, 10, 64)
+		}
+	}
+
+	lane := mq.PickLane(sizes, served, mq.LaneLimits)
+	if lane < 0 {
+		return "", nil
+	}
+	lease, err := marshalLease(workerID)
+	if err != nil {
+		return "", err
+	}
+	v, err := claimScript.Run(redisClient,
+		[]string{keys[lane], mq.SyncPendingChannelKey, mq.SyncLeasesChannelKey, mq.SyncServedChannelKey},
+		lane, lease).Result()
+	if err == redis.Nil {
+		// taken by other workers in the meantime
+		return "", nil
 	}
+	if err != nil {
+		return "", err
+	}
+	msg, _ := v.(string)
+	return msg, nil
 }
 
-// Finish message processing
-func (s *MessageQueue) Finish(message string) error {
-	// remove the message in error channel
-	_, err := redisClient.LRem(mq.SyncPendingChannelKey, 1, message).Result()
-	redisClient.HDel(mq.SyncRetriesChannelKey, message).Result()
-	return err
+func marshalLease(workerID string) (string, error) {
+	b, err := json.Marshal(mq.NewLease(workerID))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
 }
 
-// Error mark message as error
-func (s *MessageQueue) Error(message string) error {
-	// add the message to error channel
-	_, err := redisClient.LPush(mq.SyncErrorChannelKey, message).Result()
+// Heartbeat extends the lease of a pending message
+func (s *MessageQueue) Heartbeat(message *mq.Message, workerID string) error {
+	lease, err := marshalLease(workerID)
 	if err != nil {
 		return err
 	}
-	_, err = redisClient.LRem(mq.SyncPendingChannelKey, 1, message).Result()
+	ok, err := runInt(heartbeatScript, []string{mq.SyncLeasesChannelKey},
+		message.String(), workerID, lease)
 	if err != nil {
 		return err
 	}
-	_, err = redisClient.HIncrBy(mq.SyncRetriesChannelKey, message, 1).Result()
+	if ok == 0 {
+		return mq.ErrLeaseLost
+	}
+	superseded, err := s.Superseded(message)
+	if err != nil {
+		return err
+	}
+	if superseded {
+		return mq.ErrSuperseded
+	}
+	return nil
+}
+
+// Finish message processing
+func (s *MessageQueue) Finish(message *mq.Message) error {
+	_, err := finishScript.Run(redisClient,
+		[]string{mq.SyncPendingChannelKey, mq.SyncRetriesChannelKey, mq.SyncLeasesChannelKey, mq.SyncIndexChannelKey,
+			mq.SyncErrorsChannelKey},
+		message.String(), message.Key()).Result()
 	return err
 }
 
-// MoveAllPendingToError moves all pending messages to error channel
-func (s *MessageQueue) MoveAllPendingToError() (int, error) {
+// Error mark message as error
+func (s *MessageQueue) Error(message *mq.Message, reason string) error {
+	// add the message to error channel with its retries and reason
+	_, err := errorScript.Run(redisClient,
+		[]string{mq.SyncPendingChannelKey, mq.SyncErrorChannelKey, mq.SyncLeasesChannelKey, mq.SyncIndexChannelKey,
+			mq.SyncRetriesChannelKey, mq.SyncErrorsChannelKey},
+		message.String(), message.Key(), reason).Result()
+	return err
+}
+
+// MoveExpiredPendingToError moves pending messages whose lease expired to
+// error channel, pending messages without lease are treated as expired
+func (s *MessageQueue) MoveExpiredPendingToError() (int, error) {
+	list, err := redisClient.LRange(mq.SyncPendingChannelKey, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().Unix()
 	count := 0
-	for {
-		_, err := redisClient.RPopLPush(mq.SyncPendingChannelKey, mq.SyncErrorChannelKey).Result()
+	for _, msg := range list {
+		// the lease is checked again in the script, it may be extended or
+		// finished in the meantime
+		n, err := runInt(reclaimScript,
+			[]string{mq.SyncPendingChannelKey, mq.SyncErrorChannelKey, mq.SyncLeasesChannelKey},
+			msg, now)
 		if err != nil {
-			break
+			return count, err
 		}
-		count++
+		count += int(n)
 	}
 	return count, nil
 }
 
-// MoveErrorToPending moves a pending message to error channel
-func (s *MessageQueue) MoveErrorToPending() (string, error) {
-	return redisClient.RPopLPush(mq.SyncErrorChannelKey, mq.SyncPendingChannelKey).Result()
+// MoveErrorToPending moves a error message to pending channel
+func (s *MessageQueue) MoveErrorToPending(workerID string) (*mq.Message, error) {
+	lease, err := marshalLease(workerID)
+	if err != nil {
+		return nil, err
+	}
+	v, err := popErrorScript.Run(redisClient,
+		[]string{mq.SyncErrorChannelKey, mq.SyncPendingChannelKey, mq.SyncLeasesChannelKey},
+		lease).Result()
+	if err != nil {
+		return nil, err
+	}
+	msg, _ := v.(string)
+	message, _ := mq.ParseMessage(msg)
+	return message, nil
 }
 
 // GetErrorTimes returns the message error times
-func (s *MessageQueue) GetErrorTimes(message string) (int64, error) {
-	times, err := redisClient.HGet(mq.SyncRetriesChannelKey, message).Result()
+func (s *MessageQueue) GetErrorTimes(message *mq.Message) (int64, error) {
+	times, err := redisClient.HGet(mq.SyncRetriesChannelKey, message.String()).Result()
 	if err != nil {
 		return 0, err
 	}
@@ -136,50 +316,210 @@ func (s *MessageQueue) GetErrorTimes(message string) (int64, error) {
 }
 
 // Retry moves the message from pending channel to queue
-func (s *MessageQueue) Retry(message string) error {
+func (s *MessageQueue) Retry(message *mq.Message) error {
 	// add the message to queue
-	_, err := redisClient.LPush(mq.SyncChannelKey, message).Result()
+	_, err := moveScript.Run(redisClient,
+		[]string{mq.SyncPendingChannelKey, mq.LaneKey(message.Lane()), mq.SyncLeasesChannelKey, mq.SyncIndexChannelKey},
+		message.String(), message.Key()).Result()
+	return err
+}
+
+// Schedule moves the message from pending channel to be retried at due
+func (s *MessageQueue) Schedule(message *mq.Message, due time.Time) error {
+	_, err := scheduleScript.Run(redisClient,
+		[]string{mq.SyncPendingChannelKey, mq.SyncScheduledChannelKey, mq.SyncLeasesChannelKey, mq.SyncIndexChannelKey},
+		message.String(), message.Key(), due.Unix()).Result()
+	return err
+}
+
+// PromoteDueRetries moves the scheduled messages whose due time has passed
+// to queue
+func (s *MessageQueue) PromoteDueRetries() (int, error) {
+	list, err := redisClient.ZRangeByScore(mq.SyncScheduledChannelKey, redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	_, err = redisClient.LRem(mq.SyncPendingChannelKey, 1, message).Result()
+	count := 0
+	for _, msg := range list {
+		message, _ := mq.ParseMessage(msg)
+		n, err := runInt(promoteScript,
+			[]string{mq.SyncScheduledChannelKey, mq.LaneKey(message.Lane())}, msg)
+		if err != nil {
+			return count, err
+		}
+		count += int(n)
+	}
+	return count, nil
+}
+
+// Dead moves the message from pending channel to dead-letter channel
+func (s *MessageQueue) Dead(message *mq.Message) error {
+	_, err := moveScript.Run(redisClient,
+		[]string{mq.SyncPendingChannelKey, mq.SyncDeadChannelKey, mq.SyncLeasesChannelKey, mq.SyncIndexChannelKey},
+		message.String(), message.Key()).Result()
 	return err
 }
 
-// Exists checks if message is in the queue
-// TODO: add test
-func (s *MessageQueue) Exists(message string) (bool, error) {
-	// SyncChannelKey
-	list, err := redisClient.LRange(mq.SyncChannelKey, 0, -1).Result()
+// List returns the messages in channel, the oldest first
+func (s *MessageQueue) List(channel string) ([]*mq.Entry, error) {
+	keys, err := channelKeys(channel)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	for _, v := range list {
-		if v == message {
-			return true, nil
+	var entries []*mq.Entry
+	for _, key := range keys {
+		if key == mq.SyncScheduledChannelKey {
+			list, err := redisClient.ZRangeWithScores(key, 0, -1).Result()
+			if err != nil {
+				return nil, err
+			}
+			for _, z := range list {
+				msg, _ := z.Member.(string)
+				m, _ := mq.ParseMessage(msg)
+				entries = append(entries, &mq.Entry{Message: m, Due: time.Unix(int64(z.Score), 0)})
+			}
+			continue
+		}
+		list, err := redisClient.LRange(key, 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		// messages are pushed to the head of list
+		for i := len(list) - 1; i >= 0; i-- {
+			m, _ := mq.ParseMessage(list[i])
+			entries = append(entries, &mq.Entry{Message: m})
 		}
 	}
+	if len(entries) == 0 {
+		return entries, nil
+	}
 
-	// SyncPendingChannelKey
-	list, err = redisClient.LRange(mq.SyncPendingChannelKey, 0, -1).Result()
+	fields := make([]string, len(entries))
+	for i, e := range entries {
+		fields[i] = e.Message.String()
+	}
+	retries, err := redisClient.HMGet(mq.SyncRetriesChannelKey, fields...).Result()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	for _, v := range list {
-		if v == message {
-			return true, nil
+	lastErrors, err := redisClient.HMGet(mq.SyncErrorsChannelKey, fields...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entries {
+		if v, ok := retries[i].(string); ok {
+			e.Retries, _ = strconv.ParseInt(v, 10, 64)
+		}
+		e.LastError, _ = lastErrors[i].(string)
+	}
+	return entries, nil
+}
+
+// Requeue moves the message from channel to queue and clears its error times
+func (s *MessageQueue) Requeue(channel string, message *mq.Message) error {
+	keys, err := channelKeys(channel)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		n, err := runInt(requeueScript,
+			[]string{key, mq.LaneKey(message.Lane()), mq.SyncRetriesChannelKey, mq.SyncErrorsChannelKey,
+				mq.SyncLeasesChannelKey},
+			message.String())
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return nil
+		}
+	}
+	return mq.ErrNotFound
+}
+
+// Drop removes the message from channel
+func (s *MessageQueue) Drop(channel string, message *mq.Message) error {
+	keys, err := channelKeys(channel)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		n, err := runInt(dropScript,
+			[]string{key, mq.SyncIndexChannelKey, mq.SyncRetriesChannelKey, mq.SyncErrorsChannelKey,
+				mq.SyncLeasesChannelKey},
+			message.String(), message.Key())
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return nil
 		}
 	}
+	return mq.ErrNotFound
+}
 
-	// SyncErrorChannelKey
-	list, err = redisClient.LRange(mq.SyncErrorChannelKey, 0, -1).Result()
+// Purge removes all messages from channel
+func (s *MessageQueue) Purge(channel string) ([]*mq.Message, error) {
+	entries, err := s.List(channel)
+	if err != nil {
+		return nil, err
+	}
+	var messages []*mq.Message
+	for _, e := range entries {
+		err = s.Drop(channel, e.Message)
+		if err == mq.ErrNotFound {
+			// moved in the meantime
+			continue
+		}
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, e.Message)
+	}
+	return messages, nil
+}
+
+// Exists checks if a message with the same key is in the queue
+func (s *MessageQueue) Exists(message *mq.Message) (bool, error) {
+	return redisClient.HExists(mq.SyncIndexChannelKey, message.Key()).Result()
+}
+
+// Superseded checks if a newer commit of the same pull request has been pushed
+func (s *MessageQueue) Superseded(message *mq.Message) (bool, error) {
+	pullKey := message.PullKey()
+	if pullKey == "" {
+		return false, nil
+	}
+	sha, err := redisClient.HGet(mq.SyncHeadsChannelKey, pullKey).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
-	for _, v := range list {
-		if v == message {
-			return true, nil
+	return sha != message.Sha, nil
+}
+
+// ReportJob records the state of a job for the server
+func (s *MessageQueue) ReportJob(state []byte) error {
+	return redisClient.RPush(mq.SyncJobsChannelKey, state).Err()
+}
+
+// PopJobReports removes at most n states of jobs and returns them, the oldest
+// first
+func (s *MessageQueue) PopJobReports(n int) ([][]byte, error) {
+	v, err := popReportsScript.Run(redisClient, []string{mq.SyncJobsChannelKey}, n).Result()
+	if err != nil {
+		return nil, err
+	}
+	list, _ := v.([]interface{})
+	reports := make([][]byte, 0, len(list))
+	for _, r := range list {
+		if s, ok := r.(string); ok {
+			reports = append(reports, []byte(s))
 		}
 	}
-	return false, nil
+	return reports, nil
 }
@@ -0,0 +1,218 @@
+package redis
+
+import (
+	"gopkg.in/redis.v5"
+)
+
+// Lua scripts for the queue transitions, every transition moves the message
+// between channels and updates the index of message keys atomically.
+
+// unindex decreases the number of messages of key by n
+const unindexFunc = `
+local function unindex(index, key, n)
+	if redis.call('HINCRBY', index, key, -n) <= 0 then
+		redis.call('HDEL', index, key)
+	end
+end
+`
+
+// pushScript pushes message to its lane and drops the queued message of an
+// older commit of the same pull request from all lanes.
+// KEYS: lane, index, heads, queued, lanes...
+// ARGV: message, key, pull key, sha
+var pushScript = redis.NewScript(unindexFunc + `
+if ARGV[3] ~= '' then
+	local old = redis.call('HGET', KEYS[4], ARGV[3])
+	local oldSha = redis.call('HGET', KEYS[3], ARGV[3])
+	if old and oldSha and oldSha ~= ARGV[4] then
+		local n = 0
+		for i = 5, #KEYS do
+			n = n + redis.call('LREM', KEYS[i], 0, old)
+		end
+		if n > 0 then
+			unindex(KEYS[2], ARGV[3] .. '/commits/' .. oldSha, n)
+		end
+	end
+	redis.call('HSET', KEYS[3], ARGV[3], ARGV[4])
+	redis.call('HSET', KEYS[4], ARGV[3], ARGV[1])
+end
+redis.call('LPUSH', KEYS[1], ARGV[1])
+redis.call('HINCRBY', KEYS[2], ARGV[2], 1)
+return 1
+`)
+
+// claimScript moves the oldest message of lane to pending channel with lease,
+// and counts the messages taken from the lane in a row.
+// KEYS: lane, pending, leases, served
+// ARGV: lane index, lease
+var claimScript = redis.NewScript(`
+local v = redis.call('RPOPLPUSH', KEYS[1], KEYS[2])
+if v then
+	redis.call('HSET', KEYS[3], v, ARGV[2])
+	local lane = tonumber(ARGV[1])
+	for i = 0, lane - 1 do
+		redis.call('HSET', KEYS[4], i, 0)
+	end
+	redis.call('HINCRBY', KEYS[4], lane, 1)
+end
+return v
+`)
+
+// heartbeatScript extends the lease if it is held by the worker.
+// KEYS: leases
+// ARGV: message, worker id, lease
+var heartbeatScript = redis.NewScript(`
+local v = redis.call('HGET', KEYS[1], ARGV[1])
+if not v or cjson.decode(v)['worker'] ~= ARGV[2] then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+return 1
+`)
+
+// finishScript removes message from pending channel.
+// KEYS: pending, retries, leases, index, errors
+// ARGV: message, key
+var finishScript = redis.NewScript(unindexFunc + `
+local n = redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+redis.call('HDEL', KEYS[5], ARGV[1])
+if n > 0 then
+	unindex(KEYS[4], ARGV[2], n)
+end
+return n
+`)
+
+// moveScript moves message from pending channel to channel to, the message is
+// added to channel to even if it does not exist in pending channel.
+// KEYS: pending, to, leases, index
+// ARGV: message, key
+var moveScript = redis.NewScript(`
+local n = redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('LPUSH', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+if n == 0 then
+	redis.call('HINCRBY', KEYS[4], ARGV[2], 1)
+end
+return n
+`)
+
+// errorScript moves message from pending channel to error channel, increases
+// its retries and records the reason, the message is added to error channel
+// even if it does not exist in pending channel.
+// KEYS: pending, error, leases, index, retries, errors
+// ARGV: message, key, reason
+var errorScript = redis.NewScript(`
+local n = redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('LPUSH', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+if n == 0 then
+	redis.call('HINCRBY', KEYS[4], ARGV[2], 1)
+end
+redis.call('HINCRBY', KEYS[5], ARGV[1], 1)
+redis.call('HSET', KEYS[6], ARGV[1], ARGV[3])
+return n
+`)
+
+// reclaimScript moves message from pending channel to error channel if its
+// lease is missing or expired.
+// KEYS: pending, error, leases
+// ARGV: message, now
+var reclaimScript = redis.NewScript(`
+local v = redis.call('HGET', KEYS[3], ARGV[1])
+if v and cjson.decode(v)['expire'] >= tonumber(ARGV[2]) then
+	return 0
+end
+local n = redis.call('LREM', KEYS[1], 1, ARGV[1])
+if n > 0 then
+	redis.call('LPUSH', KEYS[2], ARGV[1])
+	redis.call('HDEL', KEYS[3], ARGV[1])
+end
+return n
+`)
+
+// popErrorScript moves the oldest message of error channel to pending channel
+// with lease.
+// KEYS: error, pending, leases
+// ARGV: lease
+var popErrorScript = redis.NewScript(`
+local v = redis.call('RPOPLPUSH', KEYS[1], KEYS[2])
+if v then
+	redis.call('HSET', KEYS[3], v, ARGV[1])
+end
+return v
+`)
+
+// scheduleScript moves message from pending channel to the retry schedule,
+// the message is scheduled even if it does not exist in pending channel.
+// KEYS: pending, scheduled, leases, index
+// ARGV: message, key, due time
+var scheduleScript = redis.NewScript(`
+local n = redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+if n == 0 then
+	redis.call('HINCRBY', KEYS[4], ARGV[2], 1)
+end
+return n
+`)
+
+// promoteScript moves message from the retry schedule to its lane.
+// KEYS: scheduled, lane
+// ARGV: message
+var promoteScript = redis.NewScript(`
+local n = redis.call('ZREM', KEYS[1], ARGV[1])
+if n > 0 then
+	redis.call('LPUSH', KEYS[2], ARGV[1])
+end
+return n
+`)
+
+// removeFunc removes message from a list or sorted set
+const removeFunc = `
+local function remove(key, msg)
+	if redis.call('TYPE', key)['ok'] == 'zset' then
+		return redis.call('ZREM', key, msg)
+	end
+	return redis.call('LREM', key, 1, msg)
+end
+`
+
+// dropScript removes message from channel and clears its state.
+// KEYS: channel, index, retries, errors, leases
+// ARGV: message, key
+var dropScript = redis.NewScript(unindexFunc + removeFunc + `
+local n = remove(KEYS[1], ARGV[1])
+if n > 0 then
+	unindex(KEYS[2], ARGV[2], n)
+	redis.call('HDEL', KEYS[3], ARGV[1])
+	redis.call('HDEL', KEYS[4], ARGV[1])
+	redis.call('HDEL', KEYS[5], ARGV[1])
+end
+return n
+`)
+
+// requeueScript moves message from channel to its lane and clears its state.
+// KEYS: channel, lane, retries, errors, leases
+// ARGV: message
+var requeueScript = redis.NewScript(removeFunc + `
+local n = remove(KEYS[1], ARGV[1])
+if n > 0 then
+	redis.call('LPUSH', KEYS[2], ARGV[1])
+	redis.call('HDEL', KEYS[3], ARGV[1])
+	redis.call('HDEL', KEYS[4], ARGV[1])
+	redis.call('HDEL', KEYS[5], ARGV[1])
+end
+return n
+`)
+
+// popReportsScript removes at most n reports of jobs from the head of list.
+// KEYS: jobs
+// ARGV: n
+var popReportsScript = redis.NewScript(`
+local n = tonumber(ARGV[1])
+local reports = redis.call('LRANGE', KEYS[1], 0, n - 1)
+redis.call('LTRIM', KEYS[1], n, -1)
+return reports
+`)
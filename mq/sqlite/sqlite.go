@@ -0,0 +1,734 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tengattack/unified-ci/mq"
+	// import the sqlite driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	channelQueue = iota
+	channelPending
+	channelError
+	channelScheduled
+	channelDead
+)
+
+var channels = map[string]int{
+	mq.ChannelQueue:     channelQueue,
+	mq.ChannelPending:   channelPending,
+	mq.ChannelError:     channelError,
+	mq.ChannelScheduled: channelScheduled,
+	mq.ChannelDead:      channelDead,
+}
+
+// pollInterval is the max time Subscribe waits before looking at the queue
+// again, messages pushed by other processes are picked up after it at most
+const pollInterval = 5 * time.Second
+
+// Config sqlite message queue
+type Config struct {
+	File string `yaml:"file"`
+}
+
+// New func implements the storage interface for sqlite
+func New(config Config) *MessageQueue {
+	return &MessageQueue{
+		config: config,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// MessageQueue is interface structure
+type MessageQueue struct {
+	config Config
+
+	db *sqlx.DB
+	mu sync.Mutex // mu serializes queue transitions in this process
+	// notify wakes up Subscribe when a message is pushed in this process
+	notify chan struct{}
+}
+
+// Init client storage.
+func (s *MessageQueue) Init() (err error) {
+	// the database file may be shared with the store package, wait for its
+	// locks instead of failing immediately
+	s.db, err = sqlx.Connect("sqlite3", "file:"+s.config.File+"?mode=rwc&_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return err
+	}
+	s.db.SetMaxOpenConns(1)
+	// messages are moved between channels by deleting and re-inserting them,
+	// so the order of id is the order they entered their current channel
+	_, err = s.db.Exec(`CREATE TABLE IF NOT EXISTS mq_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message TEXT NOT NULL,
+		msg_key TEXT NOT NULL DEFAULT '',
+		channel INT NOT NULL DEFAULT '0',
+		priority INT NOT NULL DEFAULT '0',
+		worker_id TEXT NOT NULL DEFAULT '',
+		lease_expire INT NOT NULL DEFAULT '0',
+		due_time INT NOT NULL DEFAULT '0',
+		create_time INT NOT NULL
+	)`)
+	if err != nil {
+		s.db.Close()
+		return err
+	}
+	_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS IDX_MQ_CHANNEL ON mq_messages (channel, id)`)
+	if err != nil {
+		s.db.Close()
+		return err
+	}
+	_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS IDX_MQ_MESSAGE ON mq_messages (message, channel)`)
+	if err != nil {
+		s.db.Close()
+		return err
+	}
+	_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS IDX_MQ_KEY ON mq_messages (msg_key)`)
+	if err != nil {
+		s.db.Close()
+		return err
+	}
+	_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS IDX_MQ_LANE ON mq_messages (channel, priority, id)`)
+	if err != nil {
+		s.db.Close()
+		return err
+	}
+	// served is the number of messages taken from the lane in a row
+	_, err = s.db.Exec(`CREATE TABLE IF NOT EXISTS mq_lanes (
+		lane INT NOT NULL PRIMARY KEY,
+		served INT NOT NULL DEFAULT '0'
+	)`)
+	if err != nil {
+		s.db.Close()
+		return err
+	}
+	_, err = s.db.Exec(`CREATE TABLE IF NOT EXISTS mq_heads (
+		pull_key TEXT NOT NULL PRIMARY KEY,
+		sha TEXT NOT NULL
+	)`)
+	if err != nil {
+		s.db.Close()
+		return err
+	}
+	_, err = s.db.Exec(`CREATE TABLE IF NOT EXISTS mq_retries (
+		message TEXT NOT NULL PRIMARY KEY,
+		times INT NOT NULL DEFAULT '0',
+		last_error TEXT NOT NULL DEFAULT ''
+	)`)
+	if err != nil {
+		s.db.Close()
+		return err
+	}
+	_, err = s.db.Exec(`CREATE TABLE IF NOT EXISTS mq_job_reports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		state TEXT NOT NULL
+	)`)
+	if err != nil {
+		s.db.Close()
+		return err
+	}
+	return nil
+}
+
+// Reset client message queue.
+func (s *MessageQueue) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = s.db.Exec("DELETE FROM mq_messages WHERE channel = ?", channelQueue)
+}
+
+// Push message to queue
+func (s *MessageQueue) Push(message *mq.Message) error {
+	s.mu.Lock()
+	err := s.transact(func(tx *sqlx.Tx) error {
+		if pullKey := message.PullKey(); pullKey != "" {
+			_, err := tx.Exec("INSERT INTO mq_heads (pull_key, sha) VALUES (?, ?)"+
+				" ON CONFLICT (pull_key) DO UPDATE SET sha = excluded.sha", pullKey, message.Sha)
+			if err != nil {
+				return err
+			}
+			// drop the queued messages of older commits
+			prefix := pullKey + "/commits/"
+			_, err = tx.Exec("DELETE FROM mq_messages WHERE channel = ? AND substr(msg_key, 1, ?) = ? AND msg_key <> ?",
+				channelQueue, len(prefix), prefix, message.Key())
+			if err != nil {
+				return err
+			}
+		}
+		return insert(tx, channelQueue, message, nil)
+	})
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.wakeUp()
+	return nil
+}
+
+// Subscribe message from queue.
+func (s *MessageQueue) Subscribe(ctx context.Context, workerID string) (*mq.Message, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		message, err := s.claim(mq.NewLease(workerID))
+		if err != nil {
+			return nil, err
+		}
+		if message != nil {
+			return message, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.notify:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Heartbeat extends the lease of a pending message
+func (s *MessageQueue) Heartbeat(message *mq.Message, workerID string) error {
+	err := s.heartbeat(message, workerID)
+	if err != nil {
+		return err
+	}
+	superseded, err := s.Superseded(message)
+	if err != nil {
+		return err
+	}
+	if superseded {
+		return mq.ErrSuperseded
+	}
+	return nil
+}
+
+func (s *MessageQueue) heartbeat(message *mq.Message, workerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lease := mq.NewLease(workerID)
+	res, err := s.db.Exec("UPDATE mq_messages SET lease_expire = ? WHERE channel = ? AND message = ? AND worker_id = ?",
+		lease.Expire, channelPending, message.String(), workerID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return mq.ErrLeaseLost
+	}
+	return nil
+}
+
+// Finish message processing
+func (s *MessageQueue) Finish(message *mq.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transact(func(tx *sqlx.Tx) error {
+		_, err := tx.Exec("DELETE FROM mq_messages WHERE id = (SELECT id FROM mq_messages"+
+			" WHERE channel = ? AND message = ? ORDER BY id LIMIT 1)", channelPending, message.String())
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM mq_retries WHERE message = ?", message.String())
+		return err
+	})
+}
+
+// Error mark message as error
+func (s *MessageQueue) Error(message *mq.Message, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transact(func(tx *sqlx.Tx) error {
+		err := move(tx, channelPending, channelError, message, nil)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO mq_retries (message, times, last_error) VALUES (?, 1, ?)"+
+			" ON CONFLICT (message) DO UPDATE SET times = times + 1, last_error = excluded.last_error",
+			message.String(), reason)
+		return err
+	})
+}
+
+// MoveExpiredPendingToError moves pending messages whose lease expired to
+// error channel
+func (s *MessageQueue) MoveExpiredPendingToError() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	err := s.transact(func(tx *sqlx.Tx) error {
+		now := time.Now().Unix()
+		var messages []string
+		err := tx.Select(&messages, "SELECT message FROM mq_messages WHERE channel = ? AND lease_expire < ? ORDER BY id",
+			channelPending, now)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM mq_messages WHERE channel = ? AND lease_expire < ?",
+			channelPending, now)
+		if err != nil {
+			return err
+		}
+		for _, raw := range messages {
+			message, _ := mq.ParseMessage(raw)
+			err = insert(tx, channelError, message, nil)
+			if err != nil {
+				return err
+			}
+		}
+		count = len(messages)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// MoveErrorToPending moves the oldest error message to pending channel
+func (s *MessageQueue) MoveErrorToPending(workerID string) (*mq.Message, error) {
+	return s.popTo(channelError, channelPending, mq.NewLease(workerID))
+}
+
+// GetErrorTimes returns the message error times
+func (s *MessageQueue) GetErrorTimes(message *mq.Message) (int64, error) {
+	var times int64
+	err := s.db.Get(&times, "SELECT times FROM mq_retries WHERE message = ?", message.String())
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return times, err
+}
+
+// Retry moves the message from pending channel to queue
+func (s *MessageQueue) Retry(message *mq.Message) error {
+	s.mu.Lock()
+	err := s.transact(func(tx *sqlx.Tx) error {
+		return move(tx, channelPending, channelQueue, message, nil)
+	})
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.wakeUp()
+	return nil
+}
+
+// Schedule moves the message from pending channel to be retried at due
+func (s *MessageQueue) Schedule(message *mq.Message, due time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transact(func(tx *sqlx.Tx) error {
+		err := move(tx, channelPending, channelScheduled, message, nil)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE mq_messages SET due_time = ? WHERE id = last_insert_rowid()", due.Unix())
+		return err
+	})
+}
+
+// PromoteDueRetries moves the scheduled messages whose due time has passed
+// to queue
+func (s *MessageQueue) PromoteDueRetries() (int, error) {
+	s.mu.Lock()
+	count := 0
+	err := s.transact(func(tx *sqlx.Tx) error {
+		now := time.Now().Unix()
+		var messages []string
+		err := tx.Select(&messages, "SELECT message FROM mq_messages WHERE channel = ? AND due_time <= ? ORDER BY id",
+			channelScheduled, now)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM mq_messages WHERE channel = ? AND due_time <= ?",
+			channelScheduled, now)
+		if err != nil {
+			return err
+		}
+		for _, raw := range messages {
+			message, _ := mq.ParseMessage(raw)
+			err = insert(tx, channelQueue, message, nil)
+			if err != nil {
+				return err
+			}
+		}
+		count = len(messages)
+		return nil
+	})
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		s.wakeUp()
+	}
+	return count, nil
+}
+
+// Dead moves the message from pending channel to dead-letter channel
+func (s *MessageQueue) Dead(message *mq.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transact(func(tx *sqlx.Tx) error {
+		return move(tx, channelPending, channelDead, message, nil)
+	})
+}
+
+// List returns the messages in channel, the oldest first
+func (s *MessageQueue) List(channel string) ([]*mq.Entry, error) {
+	ch, ok := channels[channel]
+	if !ok {
+		return nil, mq.ErrUnknownChannel
+	}
+	rows, err := s.db.Queryx("SELECT m.message, m.due_time, COALESCE(r.times, 0), COALESCE(r.last_error, '')"+
+		" FROM mq_messages m LEFT JOIN mq_retries r ON r.message = m.message"+
+		" WHERE m.channel = ? ORDER BY m.priority, m.id", ch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []*mq.Entry
+	for rows.Next() {
+		var (
+			raw string
+			due int64
+			e   mq.Entry
+		)
+		err = rows.Scan(&raw, &due, &e.Retries, &e.LastError)
+		if err != nil {
+			return nil, err
+		}
+		e.Message, _ = mq.ParseMessage(raw)
+		if ch == channelScheduled {
+			e.Due = time.Unix(due, 0)
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
+
+// Requeue moves the message from channel to queue and clears its error times
+func (s *MessageQueue) Requeue(channel string, message *mq.Message) error {
+	ch, ok := channels[channel]
+	if !ok {
+		return mq.ErrUnknownChannel
+	}
+	s.mu.Lock()
+	err := s.transact(func(tx *sqlx.Tx) error {
+		err := remove(tx, ch, message)
+		if err != nil {
+			return err
+		}
+		return insert(tx, channelQueue, message, nil)
+	})
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.wakeUp()
+	return nil
+}
+
+// Drop removes the message from channel
+func (s *MessageQueue) Drop(channel string, message *mq.Message) error {
+	ch, ok := channels[channel]
+	if !ok {
+		return mq.ErrUnknownChannel
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transact(func(tx *sqlx.Tx) error {
+		return remove(tx, ch, message)
+	})
+}
+
+// Purge removes all messages from channel
+func (s *MessageQueue) Purge(channel string) ([]*mq.Message, error) {
+	ch, ok := channels[channel]
+	if !ok {
+		return nil, mq.ErrUnknownChannel
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var raws []string
+	err := s.transact(func(tx *sqlx.Tx) error {
+		err := tx.Select(&raws, "SELECT message FROM mq_messages WHERE channel = ? ORDER BY priority, id", ch)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM mq_retries WHERE message IN (SELECT message FROM mq_messages WHERE channel = ?)", ch)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM mq_messages WHERE channel = ?", ch)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*mq.Message, len(raws))
+	for i, raw := range raws {
+		messages[i], _ = mq.ParseMessage(raw)
+	}
+	return messages, nil
+}
+
+// Exists checks if a message with the same key is in the queue
+func (s *MessageQueue) Exists(message *mq.Message) (bool, error) {
+	var count int
+	err := s.db.Get(&count, "SELECT COUNT(*) FROM mq_messages WHERE msg_key = ?", message.Key())
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Superseded checks if a newer commit of the same pull request has been pushed
+func (s *MessageQueue) Superseded(message *mq.Message) (bool, error) {
+	pullKey := message.PullKey()
+	if pullKey == "" {
+		return false, nil
+	}
+	var sha string
+	err := s.db.Get(&sha, "SELECT sha FROM mq_heads WHERE pull_key = ?", pullKey)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return sha != message.Sha, nil
+}
+
+// ReportJob records the state of a job for the server
+func (s *MessageQueue) ReportJob(state []byte) error {
+	_, err := s.db.Exec("INSERT INTO mq_job_reports (state) VALUES (?)", string(state))
+	return err
+}
+
+// PopJobReports removes at most n states of jobs and returns them, the oldest
+// first
+func (s *MessageQueue) PopJobReports(n int) ([][]byte, error) {
+	var reports [][]byte
+	err := s.transact(func(tx *sqlx.Tx) error {
+		var rows []struct {
+			ID    int64  `db:"id"`
+			State string `db:"state"`
+		}
+		err := tx.Select(&rows, "SELECT id, state FROM mq_job_reports ORDER BY id LIMIT ?", n)
+		if err != nil || len(rows) == 0 {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM mq_job_reports WHERE id <= ?", rows[len(rows)-1].ID)
+		if err != nil {
+			return err
+		}
+		for _, r := range rows {
+			reports = append(reports, []byte(r.State))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// Deinit closes the sqlite database
+func (s *MessageQueue) Deinit() {
+	s.db.Close()
+}
+
+// wakeUp notifies Subscribe that messages are added to queue
+func (s *MessageQueue) wakeUp() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *MessageQueue) transact(f func(tx *sqlx.Tx) error) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = f(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// claim moves the oldest message of the lane picked by mq.PickLane to pending
+// channel with lease, and returns nil if all lanes are empty
+func (s *MessageQueue) claim(lease *mq.Lease) (*mq.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var message *mq.Message
+	err := s.transact(func(tx *sqlx.Tx) error {
+		sizes := make([]int64, mq.LaneCount)
+		served := make([]int64, mq.LaneCount)
+		rows, err := tx.Queryx("SELECT priority, COUNT(*) FROM mq_messages WHERE channel = ? GROUP BY priority", channelQueue)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var lane, size int64
+			err = rows.Scan(&lane, &size)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			if lane >= 0 && lane < mq.LaneCount {
+				sizes[lane] = size
+			}
+		}
+		rows.Close()
+		rows, err = tx.Queryx("SELECT lane, served FROM mq_lanes")
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var lane, n int64
+			err = rows.Scan(&lane, &n)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			if lane >= 0 && lane < mq.LaneCount {
+				served[lane] = n
+			}
+		}
+		rows.Close()
+
+		lane := mq.PickLane(sizes, served, mq.LaneLimits)
+		if lane < 0 {
+			return nil
+		}
+		var (
+			id  int64
+			raw string
+		)
+		row := tx.QueryRowx("SELECT id, message FROM mq_messages WHERE channel = ? AND priority = ? ORDER BY id LIMIT 1",
+			channelQueue, lane)
+		err = row.Scan(&id, &raw)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM mq_messages WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE mq_lanes SET served = 0 WHERE lane < ?", lane)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO mq_lanes (lane, served) VALUES (?, 1)"+
+			" ON CONFLICT (lane) DO UPDATE SET served = served + 1", lane)
+		if err != nil {
+			return err
+		}
+		// malformed messages are still returned to be finished by the handler
+		message, _ = mq.ParseMessage(raw)
+		return insert(tx, channelPending, message, lease)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// popTo moves the oldest message of channel from to channel to with lease,
+// and returns nil if there is no message in channel from
+func (s *MessageQueue) popTo(from, to int, lease *mq.Lease) (*mq.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var message *mq.Message
+	err := s.transact(func(tx *sqlx.Tx) error {
+		var (
+			id  int64
+			raw string
+		)
+		row := tx.QueryRowx("SELECT id, message FROM mq_messages WHERE channel = ? ORDER BY id LIMIT 1", from)
+		err := row.Scan(&id, &raw)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM mq_messages WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		// malformed messages are still returned to be finished by the handler
+		message, _ = mq.ParseMessage(raw)
+		return insert(tx, to, message, lease)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// move moves a message from channel from to channel to, the message is added
+// to channel to even if it does not exist in channel from, as redis does
+func move(tx *sqlx.Tx, from, to int, message *mq.Message, lease *mq.Lease) error {
+	_, err := tx.Exec("DELETE FROM mq_messages WHERE id = (SELECT id FROM mq_messages"+
+		" WHERE channel = ? AND message = ? ORDER BY id LIMIT 1)", from, message.String())
+	if err != nil {
+		return err
+	}
+	return insert(tx, to, message, lease)
+}
+
+// remove deletes message from channel with its error times, mq.ErrNotFound
+// is returned if the message is not in channel
+func remove(tx *sqlx.Tx, channel int, message *mq.Message) error {
+	res, err := tx.Exec("DELETE FROM mq_messages WHERE id = (SELECT id FROM mq_messages"+
+		" WHERE channel = ? AND message = ? ORDER BY id LIMIT 1)", channel, message.String())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return mq.ErrNotFound
+	}
+	_, err = tx.Exec("DELETE FROM mq_retries WHERE message = ?", message.String())
+	return err
+}
+
+// insert adds message to channel, lease is nil for messages not held by any
+// worker
+func insert(e sqlx.Execer, channel int, message *mq.Message, lease *mq.Lease) error {
+	var (
+		workerID string
+		expire   int64
+	)
+	if lease != nil {
+		workerID = lease.WorkerID
+		expire = lease.Expire
+	}
+	_, err := e.Exec("INSERT INTO mq_messages (message, msg_key, channel, priority, worker_id, lease_expire, create_time)"+
+		" VALUES (?, ?, ?, ?, ?, ?, ?)",
+		message.String(), message.Key(), channel, message.Lane(), workerID, expire, time.Now().Unix())
+	return err
+}
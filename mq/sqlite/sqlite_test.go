@@ -0,0 +1,316 @@
+package sqlite
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tengattack/unified-ci/mq"
+)
+
+func TestMessageQueue(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fileDB := "mq test.db"
+	q := New(Config{File: fileDB})
+	require.NoError(q.Init())
+	defer os.Remove(fileDB)
+	defer q.Deinit()
+
+	m1, err := mq.ParseMessage("owner/repo/pull/1/commits/sha1")
+	require.NoError(err)
+	m2 := mq.NewPullMessage("owner", "repo", 2, "sha2")
+	require.NoError(q.Push(m1))
+	require.NoError(q.Push(m2))
+
+	exists, err := q.Exists(m1)
+	assert.NoError(err)
+	assert.True(exists)
+	// same commit of a different message
+	exists, err = q.Exists(mq.NewPullMessage("owner", "repo", 1, "sha1"))
+	assert.NoError(err)
+	assert.True(exists)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// first in, first out
+	message, err := q.Subscribe(ctx, "worker1")
+	require.NoError(err)
+	assert.Equal(m1.String(), message.String())
+
+	assert.NoError(q.Heartbeat(m1, "worker1"))
+	assert.Equal(mq.ErrLeaseLost, q.Heartbeat(m1, "worker2"))
+	// lease of m1 is alive
+	count, err := q.MoveExpiredPendingToError()
+	assert.NoError(err)
+	assert.Equal(0, count)
+
+	require.NoError(q.Error(m1, "test failed"))
+	times, err := q.GetErrorTimes(m1)
+	assert.NoError(err)
+	assert.EqualValues(1, times)
+	entries, err := q.List(mq.ChannelError)
+	assert.NoError(err)
+	require.Len(entries, 1)
+	assert.Equal(m1.String(), entries[0].Message.String())
+	assert.EqualValues(1, entries[0].Retries)
+	assert.Equal("test failed", entries[0].LastError)
+
+	assert.Equal(mq.ErrLeaseLost, q.Heartbeat(m1, "worker1"))
+
+	message, err = q.MoveErrorToPending("worker1")
+	assert.NoError(err)
+	assert.Equal(m1.String(), message.String())
+	assert.NoError(q.Heartbeat(m1, "worker1"))
+	message, err = q.MoveErrorToPending("worker1")
+	assert.NoError(err)
+	assert.Nil(message)
+
+	// m1 goes back to the end of queue
+	require.NoError(q.Retry(m1))
+	message, err = q.Subscribe(ctx, "worker1")
+	require.NoError(err)
+	assert.Equal(m2.String(), message.String())
+	require.NoError(q.Finish(m2))
+
+	exists, err = q.Exists(m2)
+	assert.NoError(err)
+	assert.False(exists)
+
+	message, err = q.Subscribe(ctx, "worker2")
+	require.NoError(err)
+	assert.Equal(m1.String(), message.String())
+
+	// worker2 dies while m1 is pending
+	_, err = q.db.Exec("UPDATE mq_messages SET lease_expire = ? WHERE message = ?",
+		time.Now().Add(-time.Second).Unix(), m1.String())
+	require.NoError(err)
+	count, err = q.MoveExpiredPendingToError()
+	assert.NoError(err)
+	assert.Equal(1, count)
+	assert.Equal(mq.ErrLeaseLost, q.Heartbeat(m1, "worker2"))
+
+	exists, err = q.Exists(m1)
+	assert.NoError(err)
+	assert.True(exists)
+
+	message, err = q.MoveErrorToPending("worker1")
+	assert.NoError(err)
+	assert.Equal(m1.String(), message.String())
+	require.NoError(q.Finish(m1))
+
+	times, err = q.GetErrorTimes(m1)
+	assert.NoError(err)
+	assert.EqualValues(0, times)
+
+	// nothing left
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = q.Subscribe(ctx, "worker1")
+	assert.Equal(context.DeadlineExceeded, err)
+}
+
+func TestMessageQueueSupersede(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fileDB := "mq supersede test.db"
+	q := New(Config{File: fileDB})
+	require.NoError(q.Init())
+	defer os.Remove(fileDB)
+	defer q.Deinit()
+
+	m1 := mq.NewPullMessage("owner", "repo", 1, "sha1")
+	m2 := mq.NewPullMessage("owner", "repo", 1, "sha2")
+	m3 := mq.NewPullMessage("owner", "repo", 1, "sha3")
+	other := mq.NewPullMessage("owner", "repo", 10, "sha1")
+	tree := mq.NewTreeMessage("owner", "repo", "master", "sha1")
+	require.NoError(q.Push(m1))
+	require.NoError(q.Push(other))
+	require.NoError(q.Push(tree))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// m1 is in-flight
+	message, err := q.Subscribe(ctx, "worker1")
+	require.NoError(err)
+	assert.Equal(m1.String(), message.String())
+	assert.NoError(q.Heartbeat(m1, "worker1"))
+
+	require.NoError(q.Push(m2))
+	require.NoError(q.Push(m3))
+	assert.Equal(mq.ErrSuperseded, q.Heartbeat(m1, "worker1"))
+
+	for _, m := range []*mq.Message{m1, m2} {
+		superseded, err := q.Superseded(m)
+		assert.NoError(err)
+		assert.True(superseded)
+	}
+	for _, m := range []*mq.Message{m3, other, tree} {
+		superseded, err := q.Superseded(m)
+		assert.NoError(err)
+		assert.False(superseded)
+	}
+
+	// m2 is dropped from queue
+	exists, err := q.Exists(m2)
+	assert.NoError(err)
+	assert.False(exists)
+	for _, m := range []*mq.Message{other, tree, m3} {
+		message, err = q.Subscribe(ctx, "worker1")
+		require.NoError(err)
+		assert.Equal(m.String(), message.String())
+	}
+}
+
+func TestMessageQueueLanes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	limits := mq.LaneLimits
+	mq.LaneLimits = []int{2, 2}
+	defer func() { mq.LaneLimits = limits }()
+
+	fileDB := "mq lanes test.db"
+	q := New(Config{File: fileDB})
+	require.NoError(q.Init())
+	defer os.Remove(fileDB)
+	defer q.Deinit()
+
+	background := mq.NewTreeMessage("owner", "repo", "master", "sha0")
+	background.Priority = mq.PriorityBackground
+	require.NoError(q.Push(background))
+	rerun := mq.NewPullMessage("owner", "repo", 1, "sha1")
+	rerun.Priority = mq.PriorityRerun
+	require.NoError(q.Push(rerun))
+	var pushes []*mq.Message
+	for i := 2; i <= 5; i++ {
+		m := mq.NewPullMessage("owner", "repo", i, "sha")
+		require.NoError(q.Push(m))
+		pushes = append(pushes, m)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// higher lanes first, and give way to the lower lanes after 2 messages
+	for _, m := range []*mq.Message{pushes[0], pushes[1], rerun, pushes[2], pushes[3], background} {
+		message, err := q.Subscribe(ctx, "worker1")
+		require.NoError(err)
+		assert.Equal(m.String(), message.String())
+	}
+}
+
+func TestMessageQueueRetries(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fileDB := "mq retries test.db"
+	q := New(Config{File: fileDB})
+	require.NoError(q.Init())
+	defer os.Remove(fileDB)
+	defer q.Deinit()
+
+	m1 := mq.NewPullMessage("owner", "repo", 1, "sha1")
+	m2 := mq.NewPullMessage("owner", "repo", 2, "sha2")
+	require.NoError(q.Push(m1))
+	require.NoError(q.Push(m2))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	for _, m := range []*mq.Message{m1, m2} {
+		_, err := q.Subscribe(ctx, "worker1")
+		require.NoError(err)
+		require.NoError(q.Error(m, "error"))
+		_, err = q.MoveErrorToPending("worker1")
+		require.NoError(err)
+	}
+
+	require.NoError(q.Schedule(m1, time.Now().Add(-time.Second)))
+	require.NoError(q.Schedule(m2, time.Now().Add(time.Hour)))
+	count, err := q.PromoteDueRetries()
+	assert.NoError(err)
+	assert.Equal(1, count)
+	// m2 is not due yet
+	count, err = q.PromoteDueRetries()
+	assert.NoError(err)
+	assert.Equal(0, count)
+	exists, err := q.Exists(m2)
+	assert.NoError(err)
+	assert.True(exists)
+
+	message, err := q.Subscribe(ctx, "worker1")
+	require.NoError(err)
+	assert.Equal(m1.String(), message.String())
+	require.NoError(q.Dead(m1))
+
+	dead, err := q.List(mq.ChannelDead)
+	assert.NoError(err)
+	require.Len(dead, 1)
+	assert.Equal(m1.String(), dead[0].Message.String())
+	assert.EqualValues(1, dead[0].Retries)
+	assert.Equal("error", dead[0].LastError)
+	exists, err = q.Exists(m1)
+	assert.NoError(err)
+	assert.True(exists)
+
+	require.NoError(q.Requeue(mq.ChannelDead, m1))
+	assert.Equal(mq.ErrNotFound, q.Requeue(mq.ChannelDead, m1))
+	times, err := q.GetErrorTimes(m1)
+	assert.NoError(err)
+	assert.EqualValues(0, times)
+	message, err = q.Subscribe(ctx, "worker1")
+	require.NoError(err)
+	assert.Equal(m1.String(), message.String())
+
+	scheduled, err := q.List(mq.ChannelScheduled)
+	assert.NoError(err)
+	require.Len(scheduled, 1)
+	assert.Equal(m2.String(), scheduled[0].Message.String())
+	assert.True(scheduled[0].Due.After(time.Now()))
+
+	require.NoError(q.Drop(mq.ChannelPending, m1))
+	assert.Equal(mq.ErrNotFound, q.Drop(mq.ChannelPending, m1))
+	purged, err := q.Purge(mq.ChannelScheduled)
+	assert.NoError(err)
+	require.Len(purged, 1)
+	assert.Equal(m2.String(), purged[0].String())
+	for _, m := range []*mq.Message{m1, m2} {
+		exists, err = q.Exists(m)
+		assert.NoError(err)
+		assert.False(exists)
+	}
+	_, err = q.List("unknown")
+	assert.Equal(mq.ErrUnknownChannel, err)
+}
+
+func TestMessageQueueJobReports(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fileDB := "mq reports test.db"
+	q := New(Config{File: fileDB})
+	require.NoError(q.Init())
+	defer os.Remove(fileDB)
+	defer q.Deinit()
+
+	reports, err := q.PopJobReports(2)
+	assert.NoError(err)
+	assert.Empty(reports)
+
+	for _, r := range []string{`{"id":"1"}`, `{"id":"2"}`, `{"id":"3"}`} {
+		require.NoError(q.ReportJob([]byte(r)))
+	}
+	reports, err = q.PopJobReports(2)
+	assert.NoError(err)
+	assert.Equal([][]byte{[]byte(`{"id":"1"}`), []byte(`{"id":"2"}`)}, reports)
+	reports, err = q.PopJobReports(2)
+	assert.NoError(err)
+	assert.Equal([][]byte{[]byte(`{"id":"3"}`)}, reports)
+}
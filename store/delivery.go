@@ -0,0 +1,93 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Delivery is an accepted webhook delivery
+type Delivery struct {
+	ID          string `db:"id" json:"id"`
+	Event       string `db:"event" json:"event"`
+	Action      string `db:"action" json:"action,omitempty"`
+	PayloadHash string `db:"payload_hash" json:"payload_hash"`
+	Payload     []byte `db:"payload" json:"-"`
+	// JobID is the job of the message pushed by the delivery
+	JobID      string `db:"job_id" json:"job_id,omitempty"`
+	CreateTime int64  `db:"create_time" json:"create_time"`
+}
+
+// DeliveryRetention is how long the deliveries are kept, the older ones are
+// pruned when a new delivery is saved
+var DeliveryRetention = 7 * 24 * time.Hour
+
+var rwDeliveries = new(sync.RWMutex)
+
+// HashPayload returns the hex encoded SHA-256 hash of payload
+func HashPayload(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// Save to db if the delivery does not exist, false is returned for a
+// duplicate delivery
+func (d *Delivery) Save() (bool, error) {
+	rwDeliveries.Lock()
+	defer rwDeliveries.Unlock()
+	t := time.Now().Unix()
+	if d.PayloadHash == "" {
+		d.PayloadHash = HashPayload(d.Payload)
+	}
+	_, err := db.Exec("DELETE FROM deliveries WHERE create_time < ?", t-int64(DeliveryRetention/time.Second))
+	if err != nil {
+		return false, err
+	}
+	res, err := db.Exec("INSERT OR IGNORE INTO deliveries (id, event, action, payload_hash, payload, job_id, create_time) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		d.ID, d.Event, d.Action, d.PayloadHash, d.Payload, d.JobID, t)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+	d.CreateTime = t
+	return true, nil
+}
+
+// Delete the delivery, so that it can be delivered again
+func (d *Delivery) Delete() error {
+	rwDeliveries.Lock()
+	defer rwDeliveries.Unlock()
+	_, err := db.Exec("DELETE FROM deliveries WHERE id = ?", d.ID)
+	return err
+}
+
+// UpdateDeliveryJob records the job of the message pushed by delivery
+func UpdateDeliveryJob(id, jobID string) error {
+	rwDeliveries.Lock()
+	defer rwDeliveries.Unlock()
+	_, err := db.Exec("UPDATE deliveries SET job_id = ? WHERE id = ?", jobID, id)
+	return err
+}
+
+// LoadDelivery gets a Delivery by id
+func LoadDelivery(id string) (*Delivery, error) {
+	rwDeliveries.RLock()
+	defer rwDeliveries.RUnlock()
+	var d Delivery
+	err := db.Get(&d, "SELECT * FROM deliveries WHERE id = ?", id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &d, nil
+}
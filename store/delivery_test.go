@@ -0,0 +1,62 @@
+package store
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliveries(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fileDB := "deliveries test.db"
+	require.NoError(Init(fileDB))
+	defer os.Remove(fileDB)
+	defer Deinit()
+
+	d := &Delivery{ID: "id", Event: "pull_request", Action: "opened", Payload: []byte(`{"action":"opened"}`)}
+	saved, err := d.Save()
+	assert.NoError(err)
+	assert.True(saved)
+	assert.Equal(HashPayload(d.Payload), d.PayloadHash)
+	assert.NotEmpty(d.CreateTime)
+
+	// redelivered
+	saved, err = (&Delivery{ID: "id", Event: "pull_request"}).Save()
+	assert.NoError(err)
+	assert.False(saved)
+
+	require.NoError(UpdateDeliveryJob("id", "job"))
+	d2, err := LoadDelivery("id")
+	assert.NoError(err)
+	require.NotNil(d2)
+	assert.Equal("job", d2.JobID)
+	assert.Equal(d.Payload, d2.Payload)
+	assert.Equal("opened", d2.Action)
+
+	require.NoError(d.Delete())
+	d2, err = LoadDelivery("id")
+	assert.NoError(err)
+	assert.Nil(d2)
+
+	// the expired deliveries are pruned
+	saved, err = (&Delivery{ID: "old", Event: "push"}).Save()
+	require.NoError(err)
+	require.True(saved)
+	_, err = db.Exec("UPDATE deliveries SET create_time = ? WHERE id = ?",
+		time.Now().Add(-DeliveryRetention-time.Hour).Unix(), "old")
+	require.NoError(err)
+	saved, err = (&Delivery{ID: "new", Event: "push"}).Save()
+	require.NoError(err)
+	require.True(saved)
+	d2, err = LoadDelivery("old")
+	assert.NoError(err)
+	assert.Nil(d2)
+	d2, err = LoadDelivery("new")
+	assert.NoError(err)
+	assert.NotNil(d2)
+}
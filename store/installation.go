@@ -0,0 +1,65 @@
+package store
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Installation maps the account to the installation of GitHub App
+type Installation struct {
+	Owner      string `db:"owner"`
+	ID         int64  `db:"installation_id"`
+	UpdateTime int64  `db:"update_time"`
+}
+
+var rwInstallations = new(sync.RWMutex)
+
+// Save to db
+func (i *Installation) Save() error {
+	rwInstallations.Lock()
+	defer rwInstallations.Unlock()
+	t := time.Now().Unix()
+	_, err := db.Exec("INSERT OR REPLACE INTO installations (owner, installation_id, update_time) VALUES (?, ?, ?)",
+		i.Owner, i.ID, t)
+	if err != nil {
+		return err
+	}
+	i.UpdateTime = t
+	return nil
+}
+
+// Delete from db
+func (i *Installation) Delete() error {
+	rwInstallations.Lock()
+	defer rwInstallations.Unlock()
+	_, err := db.Exec("DELETE FROM installations WHERE owner = ?", i.Owner)
+	return err
+}
+
+// LoadInstallation gets an Installation by owner
+func LoadInstallation(owner string) (*Installation, error) {
+	rwInstallations.RLock()
+	defer rwInstallations.RUnlock()
+	var i Installation
+	err := db.Get(&i, "SELECT * FROM installations WHERE owner = ?", owner)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+// ListInstallations lists all Installations
+func ListInstallations() ([]Installation, error) {
+	rwInstallations.RLock()
+	defer rwInstallations.RUnlock()
+	var i []Installation
+	err := db.Select(&i, "SELECT * FROM installations ORDER BY owner")
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
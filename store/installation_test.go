@@ -0,0 +1,41 @@
+package store
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fileDB := "installations test.db"
+	require.NoError(Init(fileDB))
+	defer os.Remove(fileDB)
+	defer Deinit()
+
+	i1 := &Installation{Owner: "owner", ID: 1}
+	i2 := &Installation{Owner: "org", ID: 2}
+	require.NoError(i1.Save())
+	require.NoError(i2.Save())
+	assert.NotEmpty(i1.UpdateTime)
+
+	// reinstalled
+	i1.ID = 3
+	require.NoError(i1.Save())
+	i, err := LoadInstallation("owner")
+	assert.NoError(err)
+	assert.Equal(i1, i)
+
+	list, err := ListInstallations()
+	assert.NoError(err)
+	assert.Equal([]Installation{*i2, *i1}, list)
+
+	require.NoError(i2.Delete())
+	i, err = LoadInstallation("org")
+	assert.NoError(err)
+	assert.Nil(i)
+}
@@ -0,0 +1,217 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	// JobError means the job failed and will be retried
+	JobError = "error"
+)
+
+// DefaultJobsLimit is the default number of jobs returned by ListJobs
+const DefaultJobsLimit = 100
+
+// Job records a message from being enqueued to being finished
+type Job struct {
+	ID           string `db:"id" json:"id"`
+	Forge        string `db:"forge" json:"forge"`
+	Owner        string `db:"owner" json:"owner"`
+	Repo         string `db:"repo" json:"repo"`
+	PRNum        int    `db:"pr_num" json:"pr,omitempty"`
+	Branch       string `db:"branch" json:"branch,omitempty"`
+	Sha          string `db:"sha" json:"sha"`
+	Event        string `db:"event" json:"event,omitempty"`
+	Status       string `db:"status" json:"status"`
+	Conclusion   string `db:"conclusion" json:"conclusion,omitempty"`
+	WorkerID     string `db:"worker_id" json:"worker,omitempty"`
+	Error        string `db:"error" json:"error,omitempty"`
+	LintProblems int    `db:"lint_problems" json:"lint_problems"`
+	TestsPassed  int    `db:"tests_passed" json:"tests_passed"`
+	TestsFailed  int    `db:"tests_failed" json:"tests_failed"`
+	TestsErrored int    `db:"tests_errored" json:"tests_errored"`
+	EnqueueTime  int64  `db:"enqueue_time" json:"enqueue_time"`
+	StartTime    int64  `db:"start_time" json:"start_time,omitempty"`
+	FinishTime   int64  `db:"finish_time" json:"finish_time,omitempty"`
+	// Duration is the seconds from the last start to finish
+	Duration int64 `db:"duration" json:"duration,omitempty"`
+}
+
+// JobFilter filters jobs by the non-empty fields
+type JobFilter struct {
+	Forge  string
+	Owner  string
+	Repo   string
+	PRNum  int
+	Status string
+	Limit  int
+}
+
+var rwJobs = new(sync.RWMutex)
+
+// Save to db
+func (j *Job) Save() error {
+	rwJobs.Lock()
+	defer rwJobs.Unlock()
+	if j.EnqueueTime == 0 {
+		j.EnqueueTime = time.Now().Unix()
+	}
+	_, err := db.NamedExec("INSERT OR REPLACE INTO jobs (id, forge, owner, repo, pr_num, branch, sha, event, status, conclusion,"+
+		" worker_id, error, lint_problems, tests_passed, tests_failed, tests_errored, enqueue_time, start_time, finish_time, duration)"+
+		" VALUES (:id, :forge, :owner, :repo, :pr_num, :branch, :sha, :event, :status, :conclusion,"+
+		" :worker_id, :error, :lint_problems, :tests_passed, :tests_failed, :tests_errored, :enqueue_time, :start_time, :finish_time, :duration)",
+		j)
+	return err
+}
+
+// Start marks the job running by worker, the results of previous runs are
+// cleared
+func (j *Job) Start(workerID string) error {
+	j.Status = JobRunning
+	j.Conclusion = ""
+	j.WorkerID = workerID
+	j.Error = ""
+	j.LintProblems = 0
+	j.TestsPassed = 0
+	j.TestsFailed = 0
+	j.TestsErrored = 0
+	j.StartTime = time.Now().Unix()
+	j.FinishTime = 0
+	j.Duration = 0
+	return j.update()
+}
+
+// Finish marks the job completed with conclusion
+func (j *Job) Finish(conclusion string) error {
+	j.Status = JobCompleted
+	j.Conclusion = conclusion
+	j.finished()
+	return j.update()
+}
+
+// Fail marks the job failed with reason
+func (j *Job) Fail(reason string) error {
+	j.Status = JobError
+	j.Error = reason
+	j.finished()
+	return j.update()
+}
+
+// FinishQueuedPullJobs marks the queued jobs of the pull request on forge at
+// commits other than sha completed with conclusion, e.g. their messages are
+// dropped by a newer commit, the number of jobs is returned
+func FinishQueuedPullJobs(forge, owner, repo string, prNum int, sha, conclusion string) (int64, error) {
+	rwJobs.Lock()
+	defer rwJobs.Unlock()
+	res, err := db.Exec("UPDATE jobs SET status = ?, conclusion = ?, finish_time = ?"+
+		" WHERE forge = ? AND owner = ? AND repo = ? AND pr_num = ? AND sha <> ? AND status = ?",
+		JobCompleted, conclusion, time.Now().Unix(), forge, owner, repo, prNum, sha, JobQueued)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Sync records the state of job reported by a worker, the job is saved if it
+// is not recorded yet
+func (j *Job) Sync() error {
+	n, err := j.updateRows()
+	if err != nil || n > 0 {
+		return err
+	}
+	return j.Save()
+}
+
+func (j *Job) update() error {
+	_, err := j.updateRows()
+	return err
+}
+
+func (j *Job) updateRows() (int64, error) {
+	rwJobs.Lock()
+	defer rwJobs.Unlock()
+	res, err := db.NamedExec("UPDATE jobs SET status = :status, conclusion = :conclusion, worker_id = :worker_id, error = :error,"+
+		" lint_problems = :lint_problems, tests_passed = :tests_passed, tests_failed = :tests_failed, tests_errored = :tests_errored,"+
+		" start_time = :start_time, finish_time = :finish_time, duration = :duration WHERE id = :id",
+		j)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (j *Job) finished() {
+	j.FinishTime = time.Now().Unix()
+	if j.StartTime > 0 {
+		j.Duration = j.FinishTime - j.StartTime
+	}
+}
+
+// LoadJob gets a Job by id
+func LoadJob(id string) (*Job, error) {
+	rwJobs.RLock()
+	defer rwJobs.RUnlock()
+	var j Job
+	err := db.Get(&j, "SELECT * FROM jobs WHERE id = ?", id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &j, nil
+}
+
+// ListJobs lists Jobs by filter, the latest enqueued first
+func ListJobs(f JobFilter) ([]Job, error) {
+	rwJobs.RLock()
+	defer rwJobs.RUnlock()
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if f.Forge != "" {
+		conds = append(conds, "forge = ?")
+		args = append(args, f.Forge)
+	}
+	if f.Owner != "" {
+		conds = append(conds, "owner = ?")
+		args = append(args, f.Owner)
+	}
+	if f.Repo != "" {
+		conds = append(conds, "repo = ?")
+		args = append(args, f.Repo)
+	}
+	if f.PRNum > 0 {
+		conds = append(conds, "pr_num = ?")
+		args = append(args, f.PRNum)
+	}
+	if f.Status != "" {
+		conds = append(conds, "status = ?")
+		args = append(args, f.Status)
+	}
+	query := "SELECT * FROM jobs"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = DefaultJobsLimit
+	}
+	query += " ORDER BY enqueue_time DESC, rowid DESC LIMIT ?"
+	args = append(args, limit)
+
+	var jobs []Job
+	err := db.Select(&jobs, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
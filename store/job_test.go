@@ -0,0 +1,112 @@
+package store
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fileDB := "jobs test.db"
+	require.NoError(Init(fileDB))
+	defer os.Remove(fileDB)
+	defer Deinit()
+
+	j1 := &Job{ID: "id1", Forge: "github", Owner: "owner", Repo: "repo", PRNum: 1, Sha: "sha1", Status: JobQueued}
+	j2 := &Job{ID: "id2", Forge: "github", Owner: "owner", Repo: "repo", Branch: "master", Sha: "sha2", Status: JobQueued}
+	j3 := &Job{ID: "id3", Forge: "github", Owner: "owner", Repo: "other", PRNum: 1, Sha: "sha3", Status: JobQueued}
+	for _, j := range []*Job{j1, j2, j3} {
+		require.NoError(j.Save())
+		assert.NotEmpty(j.EnqueueTime)
+	}
+
+	require.NoError(j1.Start("worker1"))
+	require.NoError(j1.Fail("network error"))
+	j, err := LoadJob("id1")
+	assert.NoError(err)
+	require.NotNil(j)
+	assert.Equal(JobError, j.Status)
+	assert.Equal("network error", j.Error)
+	assert.Equal("worker1", j.WorkerID)
+
+	// retried
+	require.NoError(j1.Start("worker2"))
+	j1.LintProblems = 2
+	j1.TestsPassed = 1
+	require.NoError(j1.Finish("failure"))
+	j, err = LoadJob("id1")
+	assert.NoError(err)
+	assert.Equal(j1, j)
+	assert.Equal(JobCompleted, j.Status)
+	assert.Empty(j.Error)
+	assert.Equal(2, j.LintProblems)
+	assert.NotEmpty(j.FinishTime)
+
+	j, err = LoadJob("unknown")
+	assert.NoError(err)
+	assert.Nil(j)
+
+	jobs, err := ListJobs(JobFilter{Owner: "owner", Repo: "repo"})
+	assert.NoError(err)
+	require.Len(jobs, 2)
+	// the latest first
+	assert.Equal("id2", jobs[0].ID)
+	assert.Equal("id1", jobs[1].ID)
+
+	jobs, err = ListJobs(JobFilter{PRNum: 1, Status: JobQueued})
+	assert.NoError(err)
+	require.Len(jobs, 1)
+	assert.Equal("id3", jobs[0].ID)
+
+	jobs, err = ListJobs(JobFilter{Limit: 1})
+	assert.NoError(err)
+	assert.Len(jobs, 1)
+
+	j4 := &Job{ID: "id4", Forge: "github", Owner: "owner", Repo: "other", PRNum: 1, Sha: "sha4", Status: JobQueued}
+	require.NoError(j4.Save())
+	// the merge request of another forge with the same number
+	j5 := &Job{ID: "id5", Forge: "gitlab", Owner: "owner", Repo: "other", PRNum: 1, Sha: "sha5", Status: JobQueued}
+	require.NoError(j5.Save())
+	n, err := FinishQueuedPullJobs("github", "owner", "other", 1, "sha4", "superseded")
+	assert.NoError(err)
+	assert.EqualValues(1, n)
+	j, err = LoadJob("id3")
+	assert.NoError(err)
+	require.NotNil(j)
+	assert.Equal(JobCompleted, j.Status)
+	assert.Equal("superseded", j.Conclusion)
+	assert.NotEmpty(j.FinishTime)
+	j, err = LoadJob("id4")
+	assert.NoError(err)
+	require.NotNil(j)
+	assert.Equal(JobQueued, j.Status)
+
+	jobs, err = ListJobs(JobFilter{Forge: "gitlab", Status: JobQueued})
+	assert.NoError(err)
+	require.Len(jobs, 1)
+	assert.Equal("id5", jobs[0].ID)
+
+	// reported by a worker, which does not know when the job is enqueued
+	reported := *j4
+	reported.EnqueueTime = j4.EnqueueTime + 100
+	reported.Status = JobRunning
+	reported.WorkerID = "worker3"
+	require.NoError(reported.Sync())
+	j, err = LoadJob("id4")
+	assert.NoError(err)
+	require.NotNil(j)
+	assert.Equal(JobRunning, j.Status)
+	assert.Equal("worker3", j.WorkerID)
+	assert.Equal(j4.EnqueueTime, j.EnqueueTime)
+	// not recorded by the server
+	j6 := &Job{ID: "id6", Forge: "github", Owner: "owner", Repo: "repo", Sha: "sha6", Status: JobCompleted}
+	require.NoError(j6.Sync())
+	j, err = LoadJob("id6")
+	assert.NoError(err)
+	assert.Equal(j6, j)
+}
@@ -77,6 +77,69 @@ func Init(file string) (err error) {
 		db.Close()
 		return err
 	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT NOT NULL PRIMARY KEY,
+		forge TEXT NOT NULL DEFAULT '',
+		owner TEXT NOT NULL DEFAULT '',
+		repo TEXT NOT NULL DEFAULT '',
+		pr_num INT NOT NULL DEFAULT '0',
+		branch TEXT NOT NULL DEFAULT '',
+		sha TEXT NOT NULL DEFAULT '',
+		event TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT '',
+		conclusion TEXT NOT NULL DEFAULT '',
+		worker_id TEXT NOT NULL DEFAULT '',
+		error TEXT NOT NULL DEFAULT '',
+		lint_problems INT NOT NULL DEFAULT '0',
+		tests_passed INT NOT NULL DEFAULT '0',
+		tests_failed INT NOT NULL DEFAULT '0',
+		tests_errored INT NOT NULL DEFAULT '0',
+		enqueue_time INT NOT NULL DEFAULT '0',
+		start_time INT NOT NULL DEFAULT '0',
+		finish_time INT NOT NULL DEFAULT '0',
+		duration INT NOT NULL DEFAULT '0'
+	)`)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS IDX_JOBS_OWNER_REPO_PR ON jobs (owner, repo, pr_num)`)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS IDX_JOBS_ENQUEUE_TIME ON jobs (enqueue_time)`)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS installations (
+		owner TEXT NOT NULL PRIMARY KEY,
+		installation_id INT NOT NULL,
+		update_time INT NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS deliveries (
+		id TEXT NOT NULL PRIMARY KEY,
+		event TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL DEFAULT '',
+		payload_hash TEXT NOT NULL DEFAULT '',
+		payload BLOB,
+		job_id TEXT NOT NULL DEFAULT '',
+		create_time INT NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS IDX_DELIVERIES_CREATE_TIME ON deliveries (create_time)`)
+	if err != nil {
+		db.Close()
+		return err
+	}
 	return nil
 }
 
@@ -4,12 +4,66 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 
 	"github.com/google/go-github/github"
 )
 
+// GitHub endpoints, the ones of github.com by default
+var (
+	baseURL   = "https://api.github.com/"
+	uploadURL = "https://uploads.github.com/"
+	webURL    = "https://github.com/"
+)
+
+// SetGitHubURLs sets the endpoints of GitHub Enterprise Server, e.g.
+// `https://github.example.com/api/v3/`. github.com is used if base is empty,
+// and the upload endpoint is the same as base if upload is empty.
+func SetGitHubURLs(base, upload string) error {
+	if base == "" {
+		baseURL = "https://api.github.com/"
+		uploadURL = "https://uploads.github.com/"
+		webURL = "https://github.com/"
+		return nil
+	}
+	if upload == "" {
+		upload = base
+	}
+	u, err := url.Parse(strings.TrimSuffix(base, "/") + "/")
+	if err != nil {
+		return fmt.Errorf("invalid base url: %v", err)
+	}
+	if _, err = url.Parse(upload); err != nil {
+		return fmt.Errorf("invalid upload url: %v", err)
+	}
+	baseURL = u.String()
+	uploadURL = strings.TrimSuffix(upload, "/") + "/"
+	// the web of GitHub Enterprise Server is served at the same host of API
+	u.Path = strings.TrimSuffix(u.Path, "api/v3/")
+	webURL = u.String()
+	return nil
+}
+
+// APIBaseURL returns the base URL of GitHub API without the trailing slash
+func APIBaseURL() string {
+	return strings.TrimSuffix(baseURL, "/")
+}
+
+// NewClient returns a GitHub client of the configured endpoints
+func NewClient(httpClient *http.Client) *github.Client {
+	// the endpoints are validated by SetGitHubURLs
+	client, _ := github.NewEnterpriseClient(baseURL, uploadURL, httpClient)
+	return client
+}
+
+// CloneURL returns the HTTPS clone URL of repository
+func CloneURL(owner, repo string) string {
+	return webURL + owner + "/" + repo + ".git"
+}
+
 // SearchGithubPR searches for the PR number of one commit
 func SearchGithubPR(ctx context.Context, client *github.Client, repo, sha string) (int, error) {
 	if sha == "" {
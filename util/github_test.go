@@ -2,9 +2,14 @@ package util
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"regexp"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/stretchr/testify/assert"
@@ -51,3 +56,46 @@ func TestGetBaseSHA(t *testing.T) {
 	require.NoError(err)
 	assert.Equal("94a32a63aa2a618a127a00954bb9965bff8939df", sha)
 }
+
+func TestGitHubEnterprise(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/app/installations/1/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		assert.True(strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":"token","expires_at":"%s"}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+	})
+	mux.HandleFunc("/api/v3/app/installations", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":1,"account":{"login":"owner"}}]`)
+	})
+	mux.HandleFunc("/api/v3/repos/owner/repo", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("token token", r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"name":"repo"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	require.NoError(SetGitHubURLs(server.URL+"/api/v3", ""))
+	defer SetGitHubURLs("", "")
+	defer resetJWTClient()()
+	require.NoError(InitJWTClient(1, "../config/test/sample_key.pem", nil))
+
+	ctx := context.Background()
+	installations, _, err := JWTClient.Apps.ListInstallations(ctx, nil)
+	require.NoError(err)
+	require.Len(installations, 1)
+
+	client, err := InstallationClient(1)
+	require.NoError(err)
+	assert.Equal(server.URL+"/api/v3/", client.BaseURL.String())
+	assert.Equal(server.URL+"/api/v3/", client.UploadURL.String())
+	repo, _, err := client.Repositories.Get(ctx, "owner", "repo")
+	require.NoError(err)
+	assert.Equal("repo", repo.GetName())
+
+	assert.Equal(server.URL+"/owner/repo.git", CloneURL("owner", "repo"))
+	require.NoError(SetGitHubURLs("", ""))
+	assert.Equal("https://github.com/owner/repo.git", CloneURL("owner", "repo"))
+}
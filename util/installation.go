@@ -0,0 +1,96 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/proxy"
+)
+
+// installationClient is the client of an installation, the installation
+// token of transport is reused until it expires
+type installationClient struct {
+	client    *github.Client
+	transport *ghinstallation.Transport
+	rateLimit *RateLimitTransport
+}
+
+var (
+	appsTransport *ghinstallation.AppsTransport
+
+	installationsMu sync.Mutex
+	installations   = make(map[int64]*installationClient)
+)
+
+// NewTransport returns the transport for GitHub API, through the SOCKS5 proxy
+// if socks5Proxy is not empty
+func NewTransport(socks5Proxy string) (http.RoundTripper, error) {
+	if socks5Proxy == "" {
+		return http.DefaultTransport, nil
+	}
+	dialSocksProxy, err := proxy.SOCKS5("tcp", socks5Proxy, nil, proxy.Direct)
+	if err != nil {
+		return nil, errors.New("setup proxy failed: " + err.Error())
+	}
+	return &http.Transport{Dial: dialSocksProxy.Dial}, nil
+}
+
+func getInstallationClient(installationID int64) (*installationClient, error) {
+	installationsMu.Lock()
+	defer installationsMu.Unlock()
+	if c, ok := installations[installationID]; ok {
+		return c, nil
+	}
+	if appsTransport == nil {
+		return nil, errors.New("JWT client is not initialized")
+	}
+	// refreshToken sets the BaseURL and Client of its apps transport, so every
+	// installation refreshes its token through its own copy
+	atr := *appsTransport
+	tr := ghinstallation.NewFromAppsTransport(&atr, installationID)
+	tr.BaseURL = APIBaseURL()
+	rl := NewRateLimitTransport(tr)
+	c := &installationClient{
+		client:    NewClient(&http.Client{Transport: rl}),
+		transport: tr,
+		rateLimit: rl,
+	}
+	installations[installationID] = c
+	return c, nil
+}
+
+// InstallationClient returns the shared client of installation
+func InstallationClient(installationID int64) (*github.Client, error) {
+	c, err := getInstallationClient(installationID)
+	if err != nil {
+		return nil, err
+	}
+	return c.client, nil
+}
+
+// InstallationToken returns the access token of installation, the token is
+// shared with its client and refreshed after it expires
+func InstallationToken(ctx context.Context, installationID int64) (string, error) {
+	c, err := getInstallationClient(installationID)
+	if err != nil {
+		return "", err
+	}
+	return c.transport.Token(ctx)
+}
+
+// InstallationRateLimit returns the remaining quota of installation and its
+// reset time, ok is false if it is unknown yet
+func InstallationRateLimit(installationID int64) (remaining int, reset time.Time, ok bool) {
+	installationsMu.Lock()
+	c, found := installations[installationID]
+	installationsMu.Unlock()
+	if !found {
+		return 0, time.Time{}, false
+	}
+	return c.rateLimit.RateLimit()
+}
@@ -0,0 +1,106 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// redirectRoundTripper sends all requests to host
+type redirectRoundTripper struct {
+	host string
+}
+
+func (r *redirectRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = "http"
+	req.URL.Host = r.host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// resetJWTClient clears the JWT client and the cached installation clients,
+// the returned func restores them
+func resetJWTClient() func() {
+	installationsMu.Lock()
+	defer installationsMu.Unlock()
+	atr, client, clients := appsTransport, JWTClient, installations
+	appsTransport, JWTClient, installations = nil, nil, make(map[int64]*installationClient)
+	return func() {
+		installationsMu.Lock()
+		defer installationsMu.Unlock()
+		appsTransport, JWTClient, installations = atr, client, clients
+	}
+}
+
+func TestInstallationClient(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var created int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&created, 1)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":"token-%s","expires_at":"%s"}`, r.URL.Path,
+			time.Now().Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	defer resetJWTClient()()
+
+	_, err := InstallationClient(1)
+	assert.Error(err)
+	require.NoError(InitJWTClient(1, "../config/test/sample_key.pem", &redirectRoundTripper{host: u.Host}))
+
+	c1, err := InstallationClient(1)
+	require.NoError(err)
+	c2, err := InstallationClient(1)
+	require.NoError(err)
+	assert.True(c1 == c2)
+	c3, err := InstallationClient(2)
+	require.NoError(err)
+	assert.True(c1 != c3)
+
+	ctx := context.Background()
+	token, err := InstallationToken(ctx, 1)
+	require.NoError(err)
+	assert.Equal("token-/app/installations/1/access_tokens", token)
+	// reused until it expires
+	token, err = InstallationToken(ctx, 1)
+	require.NoError(err)
+	assert.Equal("token-/app/installations/1/access_tokens", token)
+	assert.EqualValues(1, atomic.LoadInt32(&created))
+
+	// the tokens of installations are refreshed concurrently
+	var wg sync.WaitGroup
+	for _, id := range []int64{2, 3} {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			token, err := InstallationToken(ctx, id)
+			assert.NoError(err)
+			assert.Equal(fmt.Sprintf("token-/app/installations/%d/access_tokens", id), token)
+		}(id)
+	}
+	wg.Wait()
+	assert.EqualValues(3, atomic.LoadInt32(&created))
+}
+
+func TestNewTransport(t *testing.T) {
+	assert := assert.New(t)
+
+	tr, err := NewTransport("")
+	assert.NoError(err)
+	assert.Equal(http.DefaultTransport, tr)
+
+	tr, err = NewTransport("127.0.0.1:1080")
+	assert.NoError(err)
+	assert.IsType(&http.Transport{}, tr)
+}
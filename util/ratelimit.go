@@ -0,0 +1,103 @@
+package util
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MaxRateLimitRetries is the max times to retry a secondary rate limited request
+const MaxRateLimitRetries = 3
+
+// maxRetryAfter limits the time to wait before retrying
+const maxRetryAfter = 2 * time.Minute
+
+// RateLimitTransport records the rate limit of GitHub API responses, and
+// retries the secondary rate limited requests after Retry-After
+type RateLimitTransport struct {
+	transport http.RoundTripper
+
+	mu        sync.Mutex // mu protects the fields below
+	known     bool
+	remaining int
+	reset     time.Time
+}
+
+// NewRateLimitTransport wraps transport with rate limit tracking
+func NewRateLimitTransport(transport http.RoundTripper) *RateLimitTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &RateLimitTransport{transport: transport}
+}
+
+// RateLimit returns the remaining quota and its reset time from the latest
+// response, ok is false if no response has been seen
+func (t *RateLimitTransport) RateLimit() (remaining int, reset time.Time, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.remaining, t.reset, t.known
+}
+
+func (t *RateLimitTransport) update(resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	t.known = true
+	t.remaining = remaining
+	t.reset = time.Unix(reset, 0)
+	t.mu.Unlock()
+}
+
+// retryAfter returns the delay of a secondary rate limited response
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	d := time.Duration(seconds) * time.Second
+	if d > maxRetryAfter {
+		d = maxRetryAfter
+	}
+	return d, true
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for retries := 0; ; retries++ {
+		r := req.Clone(req.Context())
+		if retries > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+		resp, err := t.transport.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		t.update(resp)
+
+		delay, ok := retryAfter(resp)
+		if !ok || retries >= MaxRateLimitRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		resp.Body.Close()
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
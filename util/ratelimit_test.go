@@ -0,0 +1,60 @@
+package util
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitTransport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	reset := time.Now().Add(time.Hour).Unix()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal("body", string(body))
+		if r.URL.Path == "/limited" || requests == 1 {
+			// secondary rate limit
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "42")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tr := NewRateLimitTransport(nil)
+	_, _, ok := tr.RateLimit()
+	assert.False(ok)
+	client := &http.Client{Transport: tr}
+
+	resp, err := client.Post(server.URL+"/", "text/plain", strings.NewReader("body"))
+	require.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(2, requests)
+	remaining, resetTime, ok := tr.RateLimit()
+	assert.True(ok)
+	assert.Equal(42, remaining)
+	assert.Equal(reset, resetTime.Unix())
+
+	// gives up after max retries
+	requests = 0
+	resp, err = client.Post(server.URL+"/limited", "text/plain", strings.NewReader("body"))
+	require.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusForbidden, resp.StatusCode)
+	assert.Equal(MaxRateLimitRetries+1, requests)
+}
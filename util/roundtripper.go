@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/bradleyfalzon/ghinstallation"
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
@@ -15,7 +16,7 @@ import (
 // JWTClient is used for JWT authorization
 var JWTClient *github.Client
 
-// InitJWTClient initializes the jwtClient
+// InitJWTClient initializes the jwtClient and the installation clients
 func InitJWTClient(id int64, privateKeyFile string, tr http.RoundTripper) error {
 	privateKey, err := ioutil.ReadFile(privateKeyFile)
 	if err != nil {
@@ -24,8 +25,17 @@ func InitJWTClient(id int64, privateKeyFile string, tr http.RoundTripper) error
 	if tr == nil {
 		tr = http.DefaultTransport
 	}
-	tr = newJWTRoundTripper(id, privateKey, tr)
-	JWTClient = github.NewClient(&http.Client{Transport: tr})
+	atr, err := ghinstallation.NewAppsTransport(tr, id, privateKey)
+	if err != nil {
+		return fmt.Errorf("could not parse private key: %s", err)
+	}
+	installationsMu.Lock()
+	appsTransport = atr
+	installations = make(map[int64]*installationClient)
+	installationsMu.Unlock()
+
+	atr.BaseURL = APIBaseURL()
+	JWTClient = NewClient(&http.Client{Transport: NewRateLimitTransport(newJWTRoundTripper(id, privateKey, tr))})
 	return nil
 }
 